@@ -0,0 +1,137 @@
+package logs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//==============================Async==============================
+
+// OverflowPolicy 队列满了之后的处理方式
+type OverflowPolicy uint8
+
+const (
+	OverflowBlock      OverflowPolicy = iota //阻塞等待,直到队列有空位
+	OverflowDropNewest                       //丢弃最新的数据
+	OverflowDropOldest                       //丢弃队列中最旧的数据
+)
+
+// AsyncOption 异步输出配置
+type AsyncOption struct {
+	Size   int            //队列大小,默认1024
+	Policy OverflowPolicy //队列满了之后的处理方式,默认阻塞
+}
+
+// asyncItem 异步队列数据,由对应的实体写入到输出
+type asyncItem struct {
+	e *Entity
+	r *Record
+	p []byte
+}
+
+// newDispatcher 新建异步分发,后台协程把数据写入到实体的输出
+func newDispatcher(opt AsyncOption) *dispatcher {
+	if opt.Size <= 0 {
+		opt.Size = 1024
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dispatcher{
+		c:      make(chan *asyncItem, opt.Size),
+		policy: opt.Policy,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	register(d)
+	go d.run()
+	return d
+}
+
+// asyncHolder 实体的异步分发,加锁读写,派生的实体(With)共用
+type asyncHolder struct {
+	mu sync.RWMutex
+	d  *dispatcher
+}
+
+type dispatcher struct {
+	pending int64 //未处理完成的数量
+	dropped int64 //丢弃的数量
+	refs    int32 //使用的实体数量,全局SetAsync时多个实体共用,都不再使用时关闭
+	c       chan *asyncItem
+	policy  OverflowPolicy
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// closed 是否已经关闭,关闭后实体改为同步输出
+func (this *dispatcher) closed() bool {
+	return this.ctx.Err() != nil
+}
+
+// push 加入队列,按照策略处理队列满了的情况,返回是否加入成功
+func (this *dispatcher) push(item *asyncItem) bool {
+	atomic.AddInt64(&this.pending, 1)
+	for {
+		select {
+		case this.c <- item:
+			return true
+		default:
+		}
+		switch this.policy {
+		case OverflowDropNewest:
+			atomic.AddInt64(&this.pending, -1)
+			atomic.AddInt64(&this.dropped, 1)
+			return false
+		case OverflowDropOldest:
+			select {
+			case <-this.c:
+				atomic.AddInt64(&this.pending, -1)
+				atomic.AddInt64(&this.dropped, 1)
+			default:
+			}
+		default:
+			select {
+			case this.c <- item:
+				return true
+			case <-this.ctx.Done():
+				atomic.AddInt64(&this.pending, -1)
+				return false
+			}
+		}
+	}
+}
+
+// queued 队列中未写入的数量
+func (this *dispatcher) queued() int64 {
+	if this.closed() {
+		return 0
+	}
+	return atomic.LoadInt64(&this.pending)
+}
+
+// Flush 等待队列中的数据写入完成
+func (this *dispatcher) Flush(timeout time.Duration) error {
+	return waitFlush(timeout, func() bool {
+		return atomic.LoadInt64(&this.pending) <= 0 || this.closed()
+	})
+}
+
+// Close 停止分发,之后实体改为同步输出,需要先处理完的话先执行Flush
+func (this *dispatcher) Close() error {
+	unregister(this)
+	this.cancel()
+	return nil
+}
+
+func (this *dispatcher) run() {
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case v := <-this.c:
+			v.e.writeRecord(v.r, v.p)
+			atomic.AddInt64(&this.pending, -1)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowWriter 模拟繁忙磁盘上的文件
+type slowWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (this *slowWriter) Write(p []byte) (int, error) {
+	<-time.After(time.Microsecond * 50)
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.buf.Write(p)
+}
+
+func (this *slowWriter) Len() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.buf.Len()
+}
+
+func TestEntityAsync(t *testing.T) {
+	w := &slowWriter{}
+	e := NewEntity("测试").SetWriter(w).SetShowColor(false).SetAsync(AsyncOption{Size: 10})
+	defer e.SetSync()
+	for i := 0; i < 100; i++ {
+		e.Println("hello")
+	}
+	if err := e.getAsync().Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(w.buf.Bytes(), []byte("hello")); n != 100 {
+		t.Fatalf("expected 100 lines, got %d", n)
+	}
+
+	e.SetAsync(AsyncOption{Size: 10, Policy: OverflowDropNewest})
+	for i := 0; i < 100; i++ {
+		e.Println("hello")
+	}
+	if e.AsyncDropped() == 0 {
+		t.Fatal("expected dropped lines")
+	}
+}
+
+func TestEntityAsyncLogger(t *testing.T) {
+	w := &slowWriter{}
+	e := NewEntity("测试").SetWriter(w).SetShowColor(false).SetAsync(AsyncOption{Size: 100})
+	defer e.SetSync()
+	l := log.New(e, "", 0)
+	for i := 0; i < 50; i++ {
+		l.Printf("msg-%d", i)
+	}
+	if err := e.getAsync().Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if n := strings.Count(w.buf.String(), fmt.Sprintf("msg-%d\n", i)); n != 1 {
+			t.Fatalf("expected msg-%d once, got %d", i, n)
+		}
+	}
+}
+
+func TestEntityAsyncShared(t *testing.T) {
+	d := newDispatcher(AsyncOption{})
+	a := NewEntity("a").SetWriter(ioutil.Discard).setDispatcher(d)
+	b := NewEntity("b").SetWriter(ioutil.Discard).setDispatcher(d)
+	a.SetSync()
+	if b.getAsync() != d || d.closed() {
+		t.Fatal("shared dispatcher closed by another entity")
+	}
+	b.SetSync()
+	if !d.closed() {
+		t.Fatal("shared dispatcher not closed after last entity")
+	}
+}
+
+func BenchmarkEntitySync(b *testing.B) {
+	e := NewEntity("测试").SetWriter(ioutil.Discard, &slowWriter{}).SetShowColor(false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Println("hello")
+	}
+}
+
+func BenchmarkEntityAsync(b *testing.B) {
+	e := NewEntity("测试").SetWriter(ioutil.Discard, &slowWriter{}).SetShowColor(false)
+	e.SetAsync(AsyncOption{Size: 4096, Policy: OverflowDropOldest})
+	b.ResetTimer()
+	defer func() {
+		b.StopTimer()
+		e.SetSync()
+	}()
+	for i := 0; i < b.N; i++ {
+		e.Println("hello")
+	}
+}
+
+func BenchmarkEntityAsyncBlock(b *testing.B) {
+	e := NewEntity("测试").SetWriter(ioutil.Discard).SetShowColor(false)
+	e.SetAsync(AsyncOption{Size: 4096})
+	b.ResetTimer()
+	defer func() {
+		b.StopTimer()
+		e.SetSync()
+	}()
+	for i := 0; i < b.N; i++ {
+		e.Println("hello")
+	}
+}
@@ -0,0 +1,149 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//==============================Close==============================
+
+var (
+	// FlushTimeout Close和Fatal刷新缓存的超时时间
+	FlushTimeout = time.Second * 3
+
+	// ErrFlushTimeout 刷新超时,还有数据没写完
+	ErrFlushTimeout = errors.New("logs: flush timeout")
+
+	// ErrDropped 关闭时队列中还有数据没写完,被丢弃
+	ErrDropped = errors.New("logs: records dropped")
+
+	closers     = sync.Map{} //需要刷新和关闭的输出,例如Chan,File,Trunk
+	flushPasses = 3          //Flush的最多次数,参考Flush
+	exitCode    = -127       //Fatal退出码
+)
+
+// iFlusher 能在超时时间内把缓存的数据写完
+type iFlusher interface {
+	Flush(timeout time.Duration) error
+}
+
+// iQueue 有队列的输出,例如异步分发和Chan
+type iQueue interface {
+	queued() int64
+}
+
+// stageOf 输出所在的阶段,上游(异步分发)先刷新和关闭,然后是队列(Chan,消息总线),最后是文件等
+func stageOf(c io.Closer) int {
+	switch c.(type) {
+	case *dispatcher:
+		return 0
+	case *Chan, *trunk:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// sortedClosers 按照阶段排序的输出
+func sortedClosers() []io.Closer {
+	var list []io.Closer
+	closers.Range(func(key, value interface{}) bool {
+		list = append(list, key.(io.Closer))
+		return true
+	})
+	sort.SliceStable(list, func(i, j int) bool {
+		return stageOf(list[i]) < stageOf(list[j])
+	})
+	return list
+}
+
+// queued 所有队列中未写完的数量
+func queued() int64 {
+	n := int64(0)
+	for _, v := range sortedClosers() {
+		if q, ok := v.(iQueue); ok {
+			n += q.queued()
+		}
+	}
+	return n
+}
+
+// register 注册需要刷新和关闭的输出
+func register(c io.Closer) {
+	closers.Store(c, struct{}{})
+}
+
+// unregister 取消注册
+func unregister(c io.Closer) {
+	closers.Delete(c)
+}
+
+// Flush 把所有缓存的日志写完,包括异步分发,TCP,HTTP的队列,文件,消息总线的订阅等,超时返回错误,
+// 按照上游到下游的顺序刷新,队列不为空时(下游又写入了上游,例如订阅写入异步的实体)再刷新,最多flushPasses次
+func Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for i := 1; ; i++ {
+		var err error
+		for _, v := range sortedClosers() {
+			if f, ok := v.(iFlusher); ok {
+				if e := f.Flush(time.Until(deadline)); e != nil && err == nil {
+					err = e
+				}
+			}
+		}
+		if err != nil || i >= flushPasses || queued() <= 0 {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrFlushTimeout
+		}
+	}
+}
+
+// Close 刷新并关闭所有输出,例如异步分发,TCP,HTTP的队列,文件,消息总线的订阅等,程序退出前调用,
+// 按照上游到下游的顺序关闭,关闭时队列中还有没写完的数据返回ErrDropped,例 defer logs.Close()
+func Close() error {
+	err := Flush(FlushTimeout)
+	dropped := int64(0)
+	for _, v := range sortedClosers() {
+		if q, ok := v.(iQueue); ok {
+			dropped += q.queued()
+		}
+		if e := v.Close(); e != nil && err == nil {
+			err = e
+		}
+		closers.Delete(v)
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%w: %d records not written", ErrDropped, dropped)
+	}
+	return err
+}
+
+// SetExitCode 设置Fatal的退出码,默认-127
+func SetExitCode(code int) {
+	exitCode = code
+}
+
+// exit 关闭所有输出后退出程序
+func exit() {
+	Close()
+	os.Exit(exitCode)
+}
+
+// waitFlush 等待直到done返回true,超时返回错误
+func waitFlush(timeout time.Duration, done func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return ErrFlushTimeout
+		}
+		<-time.After(time.Millisecond * 5)
+	}
+	return nil
+}
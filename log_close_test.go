@@ -0,0 +1,53 @@
+package logs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	var count int64
+	c := newChan(context.Background(), 100)
+	c.handler = func(ctx context.Context, _ int, r *Record, bs []byte) {
+		<-time.After(time.Millisecond)
+		atomic.AddInt64(&count, 1)
+	}
+	for i := 0; i < 50; i++ {
+		c.Write([]byte("test"))
+	}
+	if err := Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&count); n != 50 {
+		t.Fatalf("expected 50 handled, got %d", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := closers.Load(c); ok {
+		t.Fatal("closed chan still registered")
+	}
+}
+
+func TestFlushAsyncChan(t *testing.T) {
+	var count int64
+	c := newChan(context.Background(), 100)
+	c.handler = func(ctx context.Context, _ int, r *Record, bs []byte) {
+		<-time.After(time.Millisecond * 5)
+		atomic.AddInt64(&count, 1)
+	}
+	defer c.Close()
+	e := NewEntity("测试").SetWriter(c).SetShowColor(false).SetAsync(AsyncOption{Size: 10})
+	defer e.SetSync()
+	for i := 0; i < 80; i++ {
+		e.Println("hello")
+	}
+	if err := Flush(FlushTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&count); n != 80 {
+		t.Fatalf("expected 80 handled, got %d", n)
+	}
+}
@@ -0,0 +1,52 @@
+package logs
+
+import (
+	"context"
+	"sync"
+)
+
+//==============================Context==============================
+
+// ContextExtractor 从context中提取字段,例如 trace_id,request_id,user_id
+type ContextExtractor func(ctx context.Context) []Field
+
+var (
+	contextExtractors []ContextExtractor
+	contextMu         sync.RWMutex
+)
+
+// RegisterContextExtractor 注册context字段提取函数,所有实体共用
+func RegisterContextExtractor(f ...ContextExtractor) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	for _, v := range f {
+		if v != nil {
+			contextExtractors = append(contextExtractors, v)
+		}
+	}
+}
+
+// RegisterContextKey 注册context的键,值存在时生成对应名称的字段
+// 例 RegisterContextKey("trace_id", traceKey{})
+func RegisterContextKey(name string, key interface{}) {
+	RegisterContextExtractor(func(ctx context.Context) []Field {
+		if val := ctx.Value(key); val != nil {
+			return []Field{{Key: name, Value: val}}
+		}
+		return nil
+	})
+}
+
+// extractContext 提取context中的字段
+func extractContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	contextMu.RLock()
+	defer contextMu.RUnlock()
+	var fields []Field
+	for _, f := range contextExtractors {
+		fields = append(fields, f(ctx)...)
+	}
+	return fields
+}
@@ -0,0 +1,36 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+type testTraceKey struct{}
+
+func TestWithContext(t *testing.T) {
+	contextMu.RLock()
+	old := contextExtractors
+	contextMu.RUnlock()
+	defer func() {
+		contextMu.Lock()
+		contextExtractors = old
+		contextMu.Unlock()
+	}()
+	RegisterContextKey("trace_id", testTraceKey{})
+	ctx := context.WithValue(context.Background(), testTraceKey{}, "abc")
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false)
+	e.WithContext(ctx).Printw("hello", "id", 1)
+	if got := buf.String(); !strings.HasSuffix(got, "hello trace_id=abc id=1\n") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+
+	buf.Reset()
+	e.WithContext(context.Background()).Println("hello")
+	if got := buf.String(); strings.Contains(got, "trace_id") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
@@ -1,11 +1,15 @@
 package logs
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/fatih/color"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Level uint8
@@ -60,22 +64,29 @@ func NewEntity(name string) *Entity {
 		Level:     LevelAll,
 		SelfLevel: LevelNone,
 	}
+	data.limiter = newLimiter(data)
+	data.async = &asyncHolder{}
 	return data
 }
 
 // Entity [信息] 2020-01-02
 type Entity struct {
-	Name       string          //名称,例如 "INFO"
-	Tag        []string        //标签.例如 "TCP"
-	caller     int             //层级,默认3级
-	callerBase int             //层级,基础
-	Color      color.Attribute //颜色
-	ShowColor  bool            //显示颜色
-	Writer     []io.Writer     //输出
-	Formatter  IFormatter      //格式
-	Level      Level           //日志等级
-	SelfLevel  Level           //自身日志等级
-	Retry      int             //重试次数
+	Name       string                       //名称,例如 "INFO"
+	Tag        []string                     //标签.例如 "TCP"
+	Fields     []Field                      //字段,例如 id=1
+	ctx        context.Context              //上下文,用于提取trace_id等字段
+	async      *asyncHolder                 //异步分发,派生的实体共用
+	onError    func(w io.Writer, err error) //输出错误处理
+	limiter    *limiter                     //采样和限流
+	caller     int                          //层级,默认3级
+	callerBase int                          //层级,基础
+	Color      color.Attribute              //颜色
+	ShowColor  bool                         //显示颜色
+	Writer     []io.Writer                  //输出
+	Formatter  IFormatter                   //格式
+	Level      Level                        //日志等级
+	SelfLevel  Level                        //自身日志等级
+	Retry      int                          //重试次数
 }
 
 // SetFormatter 设置格式化函数
@@ -111,6 +122,30 @@ func (this *Entity) SetTag(s ...string) *Entity {
 	return this
 }
 
+// GetFields 获取字段
+func (this *Entity) GetFields() []Field {
+	return this.Fields
+}
+
+// With 派生一个携带字段的实体,不影响原实体,例 With("id", 1, "name", "test")
+func (this *Entity) With(kv ...interface{}) *Entity {
+	e := *this
+	e.Fields = appendFields(this.Fields, kv...)
+	return &e
+}
+
+// Context 获取上下文,未设置时为nil
+func (this *Entity) Context() context.Context {
+	return this.ctx
+}
+
+// WithContext 派生一个携带上下文的实体,日志会带上注册的context字段(RegisterContextExtractor)
+func (this *Entity) WithContext(ctx context.Context) *Entity {
+	e := *this
+	e.ctx = ctx
+	return &e
+}
+
 // GetColor 获取颜色
 func (this *Entity) GetColor() color.Attribute {
 	return this.Color
@@ -154,6 +189,89 @@ func (this *Entity) setCaller(n int) *Entity {
 	return this
 }
 
+// SetAsync 开启异步输出,日志交给后台协程写入,不阻塞调用方,Close时会写完队列中的日志
+func (this *Entity) SetAsync(opt ...AsyncOption) *Entity {
+	o := AsyncOption{}
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	return this.setDispatcher(newDispatcher(o))
+}
+
+// SetSync 关闭异步输出,会先写完队列中的日志
+func (this *Entity) SetSync() *Entity {
+	return this.setDispatcher(nil)
+}
+
+// AsyncDropped 异步输出时,队列满了之后丢弃的日志数量
+func (this *Entity) AsyncDropped() int64 {
+	d := this.getAsync()
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&d.dropped)
+}
+
+// getAsync 获取异步分发,为nil时同步输出
+func (this *Entity) getAsync() *dispatcher {
+	if this.async == nil {
+		return nil
+	}
+	this.async.mu.RLock()
+	defer this.async.mu.RUnlock()
+	return this.async.d
+}
+
+// setDispatcher 设置异步分发,之前的分发没有其他实体使用时,写完队列中的日志并关闭
+func (this *Entity) setDispatcher(d *dispatcher) *Entity {
+	if this.async == nil {
+		this.async = &asyncHolder{}
+	}
+	if d != nil {
+		atomic.AddInt32(&d.refs, 1)
+	}
+	this.async.mu.Lock()
+	old := this.async.d
+	this.async.d = d
+	this.async.mu.Unlock()
+	if old != nil && atomic.AddInt32(&old.refs, -1) == 0 {
+		old.Flush(FlushTimeout)
+		old.Close()
+	}
+	return this
+}
+
+// SetSample 设置采样,每个周期(tick,默认1秒)内相同内容的日志先输出first条,
+// 之后每thereafter条输出1条(为0则不再输出),first<=0关闭采样,被抑制的数量会汇总输出
+func (this *Entity) SetSample(tick time.Duration, first, thereafter int) *Entity {
+	this.getLimiter().setSample(tick, first, thereafter)
+	return this
+}
+
+// SetRateLimit 设置限流(令牌桶),每秒最多输出rate条,允许突发burst条,rate<=0关闭限流
+func (this *Entity) SetRateLimit(rate float64, burst int) *Entity {
+	this.getLimiter().setRateLimit(rate, burst)
+	return this
+}
+
+func (this *Entity) getLimiter() *limiter {
+	if this.limiter == nil {
+		this.limiter = newLimiter(this)
+	}
+	return this.limiter
+}
+
+// allow 是否通过采样和限流
+func (this *Entity) allow(r *Record) bool {
+	return this.limiter == nil || this.limiter.allow(r.Message)
+}
+
+// OnError 设置输出错误处理,未设置时使用全局的OnError,都未设置则写入ErrorWriter
+func (this *Entity) OnError(fn func(w io.Writer, err error)) *Entity {
+	this.onError = fn
+	return this
+}
+
 // SetWriter 设置输出,会覆盖之前设置的输出,并不会执行Close
 func (this *Entity) SetWriter(writer ...io.Writer) *Entity {
 	this.Writer = writer
@@ -166,16 +284,35 @@ func (this *Entity) AddWriter(writer ...io.Writer) *Entity {
 	return this
 }
 
+// AddWriterWith 添加输出,并单独设置该输出的最小等级和格式化
+// 例 AddWriterWith(NewFile("./logs/app.log"), WriterOption{Formatter: FJsonRecord})
+func (this *Entity) AddWriterWith(writer io.Writer, opt WriterOption) *Entity {
+	if writer != nil {
+		this.AddWriter(&optionWriter{Writer: writer, WriterOption: opt})
+	}
+	return this
+}
+
 // WriteToConsole 输出到控制台
 func (this *Entity) WriteToConsole() *Entity {
 	this.AddWriter(os.Stdout)
 	return this
 }
 
-// WriteToFile 输出到文件 例"./output/logs/2006-01-02/{type}_15.log"
+// WriteToFile 输出到文件 例"./output/logs/2006-01-02/{type}_15.log",
+// 占位符 {type} 实体名称,{tag} 标签(多个用_连接),{pid} 进程号,{hostname} 主机名,{app} 程序名称,
+// 相同路径的实体共用一个文件(GetFile)
 func (this *Entity) WriteToFile(filename string) *Entity {
-	filename = strings.ReplaceAll(filename, "{type}", this.Name)
-	this.AddWriter(NewFile(filename, 0))
+	f := getFile(filename, map[string]string{
+		"type": this.Name,
+		"tag":  strings.Join(this.Tag, "_"),
+	})
+	for _, w := range this.Writer {
+		if w == f {
+			return this
+		}
+	}
+	this.AddWriter(f)
 	return this
 }
 
@@ -211,6 +348,32 @@ func (this *Entity) WriteToTCPServer(port int, color ...bool) error {
 	return nil
 }
 
+// WriteToTCPClientTLS 通过TLS写入TCP客户端,color 是否传输颜色数据
+func (this *Entity) WriteToTCPClientTLS(addr string, config *tls.Config, color ...bool) error {
+	writer, err := NewTCPClientTLS(addr, config)
+	if err != nil {
+		return err
+	}
+	if len(color) > 0 && color[0] {
+		writer = NewWriteColor(writer)
+	}
+	this.AddWriter(writer)
+	return nil
+}
+
+// WriteToTCPServerTLS 通过TLS写入TCP服务器,color 是否传输颜色数据
+func (this *Entity) WriteToTCPServerTLS(port int, config *tls.Config, color ...bool) error {
+	writer, err := NewTCPServerTLS(port, config)
+	if err != nil {
+		return err
+	}
+	if len(color) > 0 && color[0] {
+		writer = NewWriteColor(writer)
+	}
+	this.AddWriter(writer)
+	return nil
+}
+
 // WriteToHTTPServer 写入HTTP服务器 ,color 是否传输颜色数据
 func (this *Entity) WriteToHTTPServer(method, url string, color ...bool) error {
 	writer := NewHTTPClient(method, url)
@@ -221,27 +384,26 @@ func (this *Entity) WriteToHTTPServer(method, url string, color ...bool) error {
 	return nil
 }
 
-// Sprintf 格式化输出
-func (this *Entity) Sprintf(format string, v ...interface{}) string {
+// getFormatter 获取格式化,未设置时使用默认
+func (this *Entity) getFormatter() IFormatter {
 	if this.Formatter == nil {
 		this.Formatter = DefaultFormatter
 	}
-	return this.Formatter.Formatter(this, fmt.Sprintf(format, v...))
+	return this.Formatter
+}
+
+// Sprintf 格式化输出
+func (this *Entity) Sprintf(format string, v ...interface{}) string {
+	return formatRecord(this.getFormatter(), this.newRecord(1, fmt.Sprintf(format, v...)))
 }
 
 // Sprint 格式化输出
 func (this *Entity) Sprint(v ...interface{}) string {
-	if this.Formatter == nil {
-		this.Formatter = DefaultFormatter
-	}
-	return this.Formatter.Formatter(this, fmt.Sprint(v...))
+	return formatRecord(this.getFormatter(), this.newRecord(1, fmt.Sprint(v...)))
 }
 
 func (this *Entity) Sprintln(v ...interface{}) string {
-	if this.Formatter == nil {
-		this.Formatter = DefaultFormatter
-	}
-	return this.Formatter.Formatter(this, fmt.Sprintln(v...))
+	return formatRecord(this.getFormatter(), this.newRecord(1, fmt.Sprintln(v...)))
 }
 
 // Printf 格式化写入
@@ -249,8 +411,11 @@ func (this *Entity) Printf(format string, v ...interface{}) (int, error) {
 	if this.Level > this.SelfLevel {
 		return 0, nil
 	}
-	msg := []byte(this.Sprintf(format, v...))
-	return this.Write(msg)
+	r := this.newRecord(1, fmt.Sprintf(format, v...))
+	if !this.allow(r) {
+		return 0, nil
+	}
+	return this.WriteRecord(r, []byte(formatRecord(this.getFormatter(), r)))
 }
 
 // Print 写入内容
@@ -258,8 +423,11 @@ func (this *Entity) Print(v ...interface{}) (int, error) {
 	if this.Level > this.SelfLevel {
 		return 0, nil
 	}
-	msg := []byte(this.Sprint(v...))
-	return this.Write(msg)
+	r := this.newRecord(1, fmt.Sprint(v...))
+	if !this.allow(r) {
+		return 0, nil
+	}
+	return this.WriteRecord(r, []byte(formatRecord(this.getFormatter(), r)))
 }
 
 // Println 写入内容,换行
@@ -267,28 +435,94 @@ func (this *Entity) Println(v ...interface{}) (int, error) {
 	if this.Level > this.SelfLevel {
 		return 0, nil
 	}
-	msg := []byte(this.Sprintln(v...))
-	return this.Write(msg)
+	r := this.newRecord(1, fmt.Sprintln(v...))
+	if !this.allow(r) {
+		return 0, nil
+	}
+	return this.WriteRecord(r, []byte(formatRecord(this.getFormatter(), r)))
+}
+
+// Printw 写入内容和字段,换行,例 Printw("登录", "id", 1)
+func (this *Entity) Printw(msg string, kv ...interface{}) (int, error) {
+	if this.Level > this.SelfLevel {
+		return 0, nil
+	}
+	r := this.With(kv...).newRecord(1, fmt.Sprintln(msg))
+	if !this.allow(r) {
+		return 0, nil
+	}
+	return this.WriteRecord(r, []byte(formatRecord(this.getFormatter(), r)))
 }
 
 // Write 实现io.Writer
 func (this *Entity) Write(p []byte) (n int, err error) {
+	return this.WriteRecord(nil, p)
+}
+
+// WriteRecord 写入日志记录和格式化后的数据,支持记录的输出(IRecordWriter)会收到记录
+// 记录为nil时等同于Write,开启异步时加入队列后直接返回
+func (this *Entity) WriteRecord(r *Record, p []byte) (n int, err error) {
+	if d := this.getAsync(); d != nil && !d.closed() {
+		//异步写入时调用方可能复用p(例如log.Logger),需要复制
+		if !d.push(&asyncItem{e: this, r: r, p: append([]byte(nil), p...)}) {
+			reportError(this, this, ErrQueueFull)
+			return 0, ErrQueueFull
+		}
+		return len(p), nil
+	}
+	return this.writeRecord(r, p)
+}
+
+// writeRecord 同步写入到所有输出,返回成功写入的最大长度,
+// 失败的输出会交给OnError处理,并汇总成MultiError返回
+func (this *Entity) writeRecord(r *Record, p []byte) (n int, err error) {
+	var errs MultiError
 	for _, w := range this.Writer {
 		bs := p
 		if w == nil {
 			continue
 		}
+		if ow, ok := w.(*optionWriter); ok {
+			level := this.SelfLevel
+			if r != nil {
+				level = r.Level
+			}
+			if level < ow.Level {
+				continue
+			}
+			if ow.Formatter != nil && r != nil {
+				bs = []byte(formatRecord(ow.Formatter, r))
+			}
+		}
 		if this.ShowColor && this.isColorWriter(w) {
-			bs = []byte(color.New(this.Color).Sprint(string(p)))
+			bs = []byte(color.New(this.Color).Sprint(string(bs)))
 		}
+		rw, ok := w.(IRecordWriter)
+		var wn int
+		var werr error
 		for i := 0; i <= this.Retry; i++ {
-			n, err = w.Write(bs)
-			if err == nil {
+			if ok && r != nil {
+				wn, werr = rw.WriteRecord(r, bs)
+			} else {
+				wn, werr = w.Write(bs)
+			}
+			if werr == nil {
 				break
 			}
 		}
+		if werr != nil {
+			reportError(this, w, werr)
+			errs = append(errs, &WriterError{Writer: w, Err: werr})
+			continue
+		}
+		if wn > n {
+			n = wn
+		}
+	}
+	if len(errs) > 0 {
+		return n, errs
 	}
-	return
+	return n, nil
 }
 
 func (this *Entity) isColorWriter(w io.Writer) bool {
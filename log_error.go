@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//==============================Error==============================
+
+var (
+	// ErrQueueFull 队列已满,数据被丢弃
+	ErrQueueFull = errors.New("logs: queue full")
+
+	// ErrClosed 输出已经关闭
+	ErrClosed = errors.New("logs: closed")
+
+	// ErrorWriter 输出失败且没有设置OnError时,错误信息写入这里,为nil则忽略
+	ErrorWriter io.Writer = os.Stderr
+
+	onError   func(w io.Writer, err error) //全局的错误处理
+	onErrorMu sync.RWMutex
+)
+
+// WriterError 单个输出的写入错误
+type WriterError struct {
+	Writer io.Writer
+	Err    error
+}
+
+func (this *WriterError) Error() string {
+	return fmt.Sprintf("write to %T: %v", this.Writer, this.Err)
+}
+
+func (this *WriterError) Unwrap() error {
+	return this.Err
+}
+
+// MultiError 多个输出的写入错误
+type MultiError []error
+
+func (this MultiError) Error() string {
+	s := make([]string, len(this))
+	for i, v := range this {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Is 任意一个错误匹配即可,例 errors.Is(err, ErrQueueFull)
+func (this MultiError) Is(target error) bool {
+	for _, v := range this {
+		if errors.Is(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnError 设置全局的输出错误处理,实体没有设置OnError时使用
+func OnError(fn func(w io.Writer, err error)) {
+	onErrorMu.Lock()
+	defer onErrorMu.Unlock()
+	onError = fn
+}
+
+// reportError 处理输出错误,优先使用实体的处理函数,其次全局,最后写入ErrorWriter
+func reportError(e *Entity, w io.Writer, err error) {
+	if e != nil && e.onError != nil {
+		e.onError(w, err)
+		return
+	}
+	onErrorMu.RLock()
+	fn := onError
+	onErrorMu.RUnlock()
+	if fn != nil {
+		fn(w, err)
+		return
+	}
+	if ErrorWriter != nil {
+		fmt.Fprintf(ErrorWriter, "[logs] write to %T failed: %v\n", w, err)
+	}
+}
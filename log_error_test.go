@@ -0,0 +1,70 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+type errWriter struct{ err error }
+
+func (this errWriter) Write(p []byte) (int, error) { return 0, this.err }
+
+func TestWriteError(t *testing.T) {
+	errFirst := errors.New("first")
+	buf := bytes.NewBuffer(nil)
+	var reported []error
+	e := NewEntity("测试").SetWriter(errWriter{errFirst}, buf).SetShowColor(false)
+	e.OnError(func(w io.Writer, err error) { reported = append(reported, err) })
+
+	n, err := e.Println("hello")
+	if n != buf.Len() || !errors.Is(err, errFirst) {
+		t.Fatalf("unexpected result: %d %v", n, err)
+	}
+	if len(reported) != 1 || reported[0] != errFirst {
+		t.Fatalf("unexpected reported: %v", reported)
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	c := newChan(context.Background(), 1)
+	c.handler = func(ctx context.Context, count int, r *Record, bs []byte) { <-block }
+	defer c.Close()
+	if err := c.Try([]byte("1"), []byte("2"), []byte("3")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestAsyncQueueFullError(t *testing.T) {
+	block := make(chan struct{})
+	w := &blockWriter{block: block}
+	var mu sync.Mutex
+	var reported []error
+	e := NewEntity("测试").SetWriter(w).SetShowColor(false).SetAsync(AsyncOption{Size: 1, Policy: OverflowDropNewest})
+	e.OnError(func(w io.Writer, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	})
+	for i := 0; i < 5; i++ {
+		e.Println("hello")
+	}
+	close(block)
+	e.SetSync()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) == 0 || !errors.Is(reported[0], ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull reported, got %v", reported)
+	}
+}
+
+// blockWriter 写入时阻塞,直到block关闭
+type blockWriter struct{ block chan struct{} }
+
+func (this *blockWriter) Write(p []byte) (int, error) {
+	<-this.block
+	return len(p), nil
+}
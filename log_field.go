@@ -0,0 +1,95 @@
+package logs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//==============================Field==============================
+
+// Field 结构化字段,例 id=1
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String 输出成 k=v 的格式
+func (this Field) String() string {
+	return this.Key + "=" + quoteValue(fmt.Sprint(this.Value))
+}
+
+// F 新建字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// newFields 解析键值对,例 ("id", 1, "name", "test"),也支持直接传入Field
+// 键不是字符串时会转成字符串,最后一个键缺少值时值为nil
+func newFields(kv ...interface{}) []Field {
+	fields := make([]Field, 0, len(kv)/2+1)
+	for i := 0; i < len(kv); i++ {
+		switch v := kv[i].(type) {
+		case Field:
+			fields = append(fields, v)
+		case []Field:
+			fields = append(fields, v...)
+		default:
+			f := Field{Key: toKey(v)}
+			if i+1 < len(kv) {
+				i++
+				f.Value = kv[i]
+			}
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// appendFields 追加字段,返回新的切片,不影响原切片
+func appendFields(fields []Field, kv ...interface{}) []Field {
+	add := newFields(kv...)
+	result := make([]Field, 0, len(fields)+len(add))
+	result = append(result, fields...)
+	return append(result, add...)
+}
+
+func toKey(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// quoteValue 值包含空格,等号或引号等字符时加上引号,方便解析
+func quoteValue(s string) string {
+	if len(s) == 0 {
+		return `""`
+	}
+	if strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// buildFields 生成 " k=v k2=v2" 格式的字段
+func buildFields(fields []Field) string {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(" ")
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// joinFields 把字段追加到消息后面,保持消息最后的换行
+func joinFields(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+	ln := ""
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg, ln = msg[:len(msg)-1], "\n"
+	}
+	return msg + buildFields(fields) + ln
+}
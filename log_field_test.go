@@ -0,0 +1,31 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEntityWith(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false)
+	e.With("id", 1, "name", "a b").Printw("登录", "err", errors.New("boom"))
+	if got := buf.String(); !strings.HasSuffix(got, `登录 id=1 name="a b" err=boom`+"\n") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	if len(e.Fields) != 0 {
+		t.Fatalf("With modified the origin entity: %v", e.Fields)
+	}
+
+	buf.Reset()
+	e.SetFormatter(FJson).Printw("登录", "id", 1, "msg", "conflict")
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["id"] != float64(1) || m["fields.msg"] != "conflict" {
+		t.Fatalf("unexpected json: %s", buf.String())
+	}
+}
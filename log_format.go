@@ -1,8 +1,8 @@
 package logs
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -21,6 +21,20 @@ type IFormatter interface {
 	Formatter(e *Entity, msg string) string
 }
 
+// IRecordFormatter 基于日志记录的输出接口,IFormatter同时实现该接口时优先使用,
+// 可以获取调用位置,字段和上下文等
+type IRecordFormatter interface {
+	Format(r *Record) string
+}
+
+// formatRecord 格式化日志记录,未实现IRecordFormatter的使用IFormatter
+func formatRecord(f IFormatter, r *Record) string {
+	if v, ok := f.(IRecordFormatter); ok {
+		return v.Format(r)
+	}
+	return f.Formatter(r.Entity, r.Message)
+}
+
 var (
 	// DefaultFormatter 默认格式化可修改
 	DefaultFormatter = FDefault
@@ -31,11 +45,22 @@ var (
 	// TimeFormatter 时间格式化
 	TimeFormatter = FTime
 
-	// FTime 时间格式化
-	FTime FormatFunc = timeFormatter
+	// FTime 时间格式化,兼容旧版的FormatFunc
+	FTime FormatFunc = func(e *Entity, msg string) string {
+		return timeFormatter(e.newRecord(4, msg))
+	}
+
+	// FJson json格式化,兼容旧版的FormatFunc,调用位置按照实体格式化的层级获取,
+	// 在WriterOption或者异步输出中使用时调用位置不准确,请使用FJsonRecord
+	FJson FormatFunc = func(e *Entity, msg string) string {
+		return jsonFormatter(e.newRecord(4, msg))
+	}
+
+	// FTimeRecord 基于日志记录的时间格式化,包含字段和上下文
+	FTimeRecord RecordFunc = timeFormatter
 
-	// FJson json格式化
-	FJson FormatFunc = jsonFormatter
+	// FJsonRecord 基于日志记录的json格式化,包含字段,上下文和准确的调用位置
+	FJsonRecord RecordFunc = jsonFormatter
 )
 
 // 默认输出
@@ -56,59 +81,170 @@ func (this *formatter) SetFormatter(formatter func(e *Entity, msg string) string
 	return this
 }
 
-// Formatter 默认输出格式函数,实现接口
-func (this *formatter) Formatter(e *Entity, msg string) string {
+// Format 默认输出格式函数,实现接口
+func (this *formatter) Format(r *Record) string {
 	if this.formatter != nil {
-		return this.formatter(e, msg)
+		return this.formatter(r.Entity, r.Message)
 	}
-	writer := bytes.NewBuffer(nil)
-	msg = buildTag(e.Tag) + msg
 	prefix := ""
-	if len(e.Name) > 0 {
-		prefix = "[" + e.Name + "] "
+	if len(r.Name) > 0 {
+		prefix = "[" + r.Name + "] "
 	}
+	return formatLog(prefix, this.flag, r, buildTag(r.Tag)+joinFields(r.Message, r.Fields))
+}
 
-	hasLn := len(msg) > 0 && msg[len(msg)-1] == '\n'
-	_ = log.New(writer, prefix, this.flag).Output(e.GetCaller(), msg)
-	msg = writer.String()
-	if len(msg) > 0 && msg[len(msg)-1] == '\n' && !hasLn {
-		//去除最后一个换行,,如果没有\n,log会自动添加一个\n
-		msg = msg[:len(msg)-1]
-	}
-	return msg
+// Formatter 兼容旧版的输出接口,层级和旧版一致(e.GetCaller)
+func (this *formatter) Formatter(e *Entity, msg string) string {
+	return this.Format(e.newRecord(3, msg))
 }
 
+// FormatFunc 格式化函数,实现 IFormatter
 type FormatFunc func(e *Entity, msg string) string
 
 func (this FormatFunc) Formatter(e *Entity, msg string) string {
 	return this(e, msg)
 }
 
-func jsonFormatter(e *Entity, msg string) string {
+func (this FormatFunc) Format(r *Record) string {
+	return this(r.Entity, r.Message)
+}
+
+// RecordFunc 基于日志记录的格式化函数
+type RecordFunc func(r *Record) string
+
+func (this RecordFunc) Format(r *Record) string {
+	return this(r)
+}
+
+// Formatter 实现IFormatter,层级和旧版一致(e.GetCaller)
+func (this RecordFunc) Formatter(e *Entity, msg string) string {
+	return this(e.newRecord(3, msg))
+}
+
+// jsonFormatter 一条记录一个json,消息以换行结尾时(例如Println)在json后面换行
+func jsonFormatter(r *Record) string {
+	msg, ln := r.Message, ""
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg, ln = msg[:len(msg)-1], "\n"
+	}
 	logMap := map[string]interface{}{
-		"level": e.Name,
-		"time":  time.Now().Format(time.RFC3339),
-		"tag":   e.Tag,
-		"msg":   msg,
+		"level":  r.Name,
+		"time":   r.Time.Format(time.RFC3339),
+		"tag":    r.Tag,
+		"caller": r.Caller(),
+		"msg":    msg,
+	}
+	for _, f := range r.Fields {
+		key := f.Key
+		if _, ok := logMap[key]; ok {
+			//和预设的键冲突
+			key = "fields." + key
+		}
+		logMap[key] = jsonValue(f.Value)
 	}
 	b, _ := json.Marshal(logMap)
-	return string(b)
+	return string(b) + ln
 }
 
-func timeFormatter(e *Entity, msg string) string {
-	writer := bytes.NewBuffer(nil)
-	msg = buildTag(e.Tag) + msg
-	if len(e.Name) > 0 {
-		msg = "[" + e.Name + "] " + msg
+// jsonValue 转成能正常序列化的值,例如error
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return val.Error()
+	case json.Marshaler:
+		return val
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
 	}
+	return v
+}
+
+func timeFormatter(r *Record) string {
+	msg := buildTag(r.Tag) + joinFields(r.Message, r.Fields)
+	if len(r.Name) > 0 {
+		msg = "[" + r.Name + "] " + msg
+	}
+	return formatLog("", log.Ltime, r, msg)
+}
+
+// formatLog 按照标准库log的flag格式化,不会额外添加换行
+func formatLog(prefix string, flag int, r *Record, msg string) string {
+	buf := make([]byte, 0, len(prefix)+len(msg)+64)
+	if flag&log.Lmsgprefix == 0 {
+		buf = append(buf, prefix...)
+	}
+	buf = formatHeader(buf, flag, r.Time, r.File, r.Line)
+	if flag&log.Lmsgprefix != 0 {
+		buf = append(buf, prefix...)
+	}
+	return string(append(buf, msg...))
+}
+
+// formatHeader 和标准库log的头部格式保持一致
+func formatHeader(buf []byte, flag int, t time.Time, file string, line int) []byte {
+	if flag&(log.Ldate|log.Ltime|log.Lmicroseconds) != 0 {
+		if flag&log.LUTC != 0 {
+			t = t.UTC()
+		}
+		if flag&log.Ldate != 0 {
+			year, month, day := t.Date()
+			buf = itoa(buf, year, 4)
+			buf = append(buf, '/')
+			buf = itoa(buf, int(month), 2)
+			buf = append(buf, '/')
+			buf = itoa(buf, day, 2)
+			buf = append(buf, ' ')
+		}
+		if flag&(log.Ltime|log.Lmicroseconds) != 0 {
+			hour, min, sec := t.Clock()
+			buf = itoa(buf, hour, 2)
+			buf = append(buf, ':')
+			buf = itoa(buf, min, 2)
+			buf = append(buf, ':')
+			buf = itoa(buf, sec, 2)
+			if flag&log.Lmicroseconds != 0 {
+				buf = append(buf, '.')
+				buf = itoa(buf, t.Nanosecond()/1e3, 6)
+			}
+			buf = append(buf, ' ')
+		}
+	}
+	if flag&(log.Lshortfile|log.Llongfile) != 0 {
+		if len(file) == 0 {
+			file, line = "???", 0
+		}
+		if flag&log.Lshortfile != 0 {
+			for i := len(file) - 1; i > 0; i-- {
+				if file[i] == '/' {
+					file = file[i+1:]
+					break
+				}
+			}
+		}
+		buf = append(buf, file...)
+		buf = append(buf, ':')
+		buf = itoa(buf, line, -1)
+		buf = append(buf, ": "...)
+	}
+	return buf
+}
 
-	hasLn := len(msg) > 0 && msg[len(msg)-1] == '\n'
-	_ = log.New(writer, "", log.Ltime).Output(e.GetCaller(), msg)
-	msg = writer.String()
-	if len(msg) > 0 && msg[len(msg)-1] == '\n' && !hasLn {
-		msg = msg[:len(msg)-1]
+// itoa 整数转字符串,wid为最小宽度,不足补0
+func itoa(buf []byte, i int, wid int) []byte {
+	var b [20]byte
+	bp := len(b) - 1
+	for i >= 10 || wid > 1 {
+		wid--
+		q := i / 10
+		b[bp] = byte('0' + i - q*10)
+		bp--
+		i = q
 	}
-	return msg
+	b[bp] = byte('0' + i)
+	return append(buf, b[bp:]...)
 }
 
 func buildTag(tags []string) string {
@@ -1,10 +1,11 @@
 package logs
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/fatih/color"
 	"io"
-	"os"
 	"sync"
 	"time"
 )
@@ -35,6 +36,7 @@ func init() {
 	m.Store(DefaultDebug.GetName(), DefaultDebug)
 	m.Store(DefaultWarn.GetName(), DefaultWarn)
 	m.Store(DefaultErr.GetName(), DefaultErr)
+	register(Trunk)
 }
 
 // New 新建,传入前缀
@@ -66,6 +68,23 @@ func AddWriter(fn ...io.Writer) {
 	})
 }
 
+// AddWriterWith 添加io.Writer,并单独设置该输出的最小等级和格式化
+func AddWriterWith(writer io.Writer, opt WriterOption) {
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).AddWriterWith(writer, opt)
+		return true
+	})
+}
+
+// WriteToFile 全部日志写入文件,每个实体按照占位符生成各自的文件,
+// 例 "./output/logs/2006-01-02/{app}_{type}_15.log",占位符参考 Entity.WriteToFile
+func WriteToFile(filename string) {
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).WriteToFile(filename)
+		return true
+	})
+}
+
 // WriteToTCPClient 全部日志写入TCP客户端,color是否传输颜色数据
 func WriteToTCPClient(addr string, color ...bool) (err error) {
 	var writer io.Writer
@@ -94,6 +113,34 @@ func WriteToTCPServer(port int, color ...bool) (err error) {
 	return nil
 }
 
+// WriteToTCPClientTLS 全部日志通过TLS写入TCP客户端,color是否传输颜色数据
+func WriteToTCPClientTLS(addr string, config *tls.Config, color ...bool) (err error) {
+	var writer io.Writer
+	writer, err = NewTCPClientTLS(addr, config)
+	if err != nil {
+		return err
+	}
+	if len(color) > 0 && color[0] {
+		writer = NewWriteColor(writer)
+	}
+	AddWriter(writer)
+	return nil
+}
+
+// WriteToTCPServerTLS 全部日志通过TLS写入TCP服务端,color 是否传输颜色数据
+func WriteToTCPServerTLS(port int, config *tls.Config, color ...bool) (err error) {
+	var writer io.Writer
+	writer, err = NewTCPServerTLS(port, config)
+	if err != nil {
+		return err
+	}
+	if len(color) > 0 && color[0] {
+		writer = NewWriteColor(writer)
+	}
+	AddWriter(writer)
+	return nil
+}
+
 // WriteToHTTPServer 全部日志写入到HTTP服务端,color 是否传输颜色数据
 func WriteToHTTPServer(method, url string, color ...bool) (err error) {
 	var writer io.Writer
@@ -105,6 +152,43 @@ func WriteToHTTPServer(method, url string, color ...bool) (err error) {
 	return nil
 }
 
+// SetAsync 全部日志开启异步输出,共用一个队列,保持日志顺序
+func SetAsync(opt ...AsyncOption) {
+	o := AsyncOption{}
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	d := newDispatcher(o)
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).setDispatcher(d)
+		return true
+	})
+}
+
+// SetSync 全部日志关闭异步输出,共用的队列在最后一个实体关闭时写完并关闭
+func SetSync() {
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).SetSync()
+		return true
+	})
+}
+
+// SetSample 全部日志设置采样,参考 Entity.SetSample
+func SetSample(tick time.Duration, first, thereafter int) {
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).SetSample(tick, first, thereafter)
+		return true
+	})
+}
+
+// SetRateLimit 全部日志设置限流,参考 Entity.SetRateLimit
+func SetRateLimit(rate float64, burst int) {
+	m.Range(func(key, value interface{}) bool {
+		value.(*Entity).SetRateLimit(rate, burst)
+		return true
+	})
+}
+
 // SetCaller 日志位置层级
 func SetCaller(n int) {
 	m.Range(func(key, value interface{}) bool {
@@ -190,6 +274,18 @@ func Tracef(format string, s ...interface{}) (int, error) {
 	return DefaultTrace.Printf(format, s...)
 }
 
+// Tracew 预设追溯 绿色,附带字段,例 Tracew("登录", "id", 1)
+// [追溯] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Tracew(msg string, kv ...interface{}) (int, error) {
+	return DefaultTrace.Printw(msg, kv...)
+}
+
+// TraceCtx 预设追溯 绿色,附带context中的字段
+// [追溯] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func TraceCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultTrace.WithContext(ctx).Println(s...)
+}
+
 // Debug 预设调试 黄色
 // [调试] 2022/01/08 10:44:02 init_test.go:10:
 func Debug(s ...interface{}) (int, error) {
@@ -202,6 +298,18 @@ func Debugf(format string, s ...interface{}) (int, error) {
 	return DefaultDebug.Printf(format, s...)
 }
 
+// Debugw 预设调试 黄色,附带字段,例 Debugw("登录", "id", 1)
+// [调试] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Debugw(msg string, kv ...interface{}) (int, error) {
+	return DefaultDebug.Printw(msg, kv...)
+}
+
+// DebugCtx 预设调试 黄色,附带context中的字段
+// [调试] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func DebugCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultDebug.WithContext(ctx).Println(s...)
+}
+
 // Read 预设读取 蓝色
 // [读取] 2022/01/08 10:44:02 init_test.go:10:
 func Read(s ...interface{}) (int, error) {
@@ -214,6 +322,18 @@ func Readf(format string, s ...interface{}) (int, error) {
 	return DefaultRead.Printf(format, s...)
 }
 
+// Readw 预设读取 蓝色,附带字段,例 Readw("登录", "id", 1)
+// [读取] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Readw(msg string, kv ...interface{}) (int, error) {
+	return DefaultRead.Printw(msg, kv...)
+}
+
+// ReadCtx 预设读取 蓝色,附带context中的字段
+// [读取] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func ReadCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultRead.WithContext(ctx).Println(s...)
+}
+
 // Write 预设写入 蓝色
 // [写入] 2022/01/08 10:44:02 init_test.go:10:
 func Write(s ...interface{}) (int, error) {
@@ -226,6 +346,18 @@ func Writef(format string, s ...interface{}) (int, error) {
 	return DefaultWrite.Printf(format, s...)
 }
 
+// Writew 预设写入 蓝色,附带字段,例 Writew("登录", "id", 1)
+// [写入] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Writew(msg string, kv ...interface{}) (int, error) {
+	return DefaultWrite.Printw(msg, kv...)
+}
+
+// WriteCtx 预设写入 蓝色,附带context中的字段
+// [写入] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func WriteCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultWrite.WithContext(ctx).Println(s...)
+}
+
 // Info 预设信息 青色
 // [信息] 2022/01/08 10:44:02 init_test.go:10:
 func Info(s ...interface{}) (int, error) {
@@ -238,6 +370,18 @@ func Infof(format string, s ...interface{}) (int, error) {
 	return DefaultInfo.Printf(format, s...)
 }
 
+// Infow 预设信息 青色,附带字段,例 Infow("登录", "id", 1)
+// [信息] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Infow(msg string, kv ...interface{}) (int, error) {
+	return DefaultInfo.Printw(msg, kv...)
+}
+
+// InfoCtx 预设信息 青色,附带context中的字段
+// [信息] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func InfoCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultInfo.WithContext(ctx).Println(s...)
+}
+
 // Warn 预设警告
 // [警告] 2022/01/08 10:44:02 init_test.go:10:
 func Warn(s ...interface{}) (int, error) {
@@ -249,6 +393,18 @@ func Warnf(format string, s ...interface{}) (int, error) {
 	return DefaultWarn.Printf(format, s...)
 }
 
+// Warnw 预设警告,附带字段,例 Warnw("登录", "id", 1)
+// [警告] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Warnw(msg string, kv ...interface{}) (int, error) {
+	return DefaultWarn.Printw(msg, kv...)
+}
+
+// WarnCtx 预设警告,附带context中的字段
+// [警告] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func WarnCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultWarn.WithContext(ctx).Println(s...)
+}
+
 // Err 预设错误 红色 写入文件
 // [错误] 2022/01/08 10:44:02 init_test.go:10:
 func Err(s ...interface{}) (int, error) {
@@ -267,6 +423,18 @@ func Errorf(format string, s ...interface{}) (int, error) {
 	return DefaultErr.Printf(format, s...)
 }
 
+// Errorw 预设错误 红色 写入文件,附带字段,例 Errorw("登录", "id", 1)
+// [错误] 2022/01/08 10:44:02 init_test.go:10: 登录 id=1
+func Errorw(msg string, kv ...interface{}) (int, error) {
+	return DefaultErr.Printw(msg, kv...)
+}
+
+// ErrorCtx 预设错误 红色 写入文件,附带context中的字段
+// [错误] 2022/01/08 10:44:02 init_test.go:10: 登录 trace_id=xxx
+func ErrorCtx(ctx context.Context, s ...interface{}) (int, error) {
+	return DefaultErr.WithContext(ctx).Println(s...)
+}
+
 // Errf 预设错误 红色 写入文件
 // [错误] 2022/01/08 10:44:02 init_test.go:10:
 func Errf(format string, s ...interface{}) (int, error) {
@@ -293,14 +461,16 @@ func Panicf(format string, s ...interface{}) (int, error) {
 
 // Fatal 预设错误 红色
 // [错误] 2022/01/08 10:44:02 init_test.go:10:
+// 退出前会执行Close,把缓存的日志写完
 func Fatal(s ...interface{}) (int, error) {
-	defer os.Exit(-127)
+	defer exit()
 	return DefaultErr.Println(s...)
 }
 
 // Fatalf 预设错误 红色
 // [错误] 2022/01/08 10:44:02 init_test.go:10:
+// 退出前会执行Close,把缓存的日志写完
 func Fatalf(format string, s ...interface{}) (int, error) {
-	defer os.Exit(-127)
+	defer exit()
 	return DefaultErr.Printf(format, s...)
 }
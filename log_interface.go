@@ -6,26 +6,40 @@ func (*Logger) Trace(v ...interface{}) { Trace(v...) }
 
 func (*Logger) Tracef(format string, v ...interface{}) { Tracef(format, v...) }
 
+func (*Logger) Tracew(msg string, kv ...interface{}) { Tracew(msg, kv...) }
+
 func (*Logger) Read(v ...interface{}) { Read(v...) }
 
 func (*Logger) Readf(format string, v ...interface{}) { Readf(format, v...) }
 
+func (*Logger) Readw(msg string, kv ...interface{}) { Readw(msg, kv...) }
+
 func (*Logger) Write(v ...interface{}) { Write(v...) }
 
 func (*Logger) Writef(format string, v ...interface{}) { Writef(format, v...) }
 
+func (*Logger) Writew(msg string, kv ...interface{}) { Writew(msg, kv...) }
+
 func (*Logger) Info(v ...interface{}) { Info(v...) }
 
 func (*Logger) Infof(format string, v ...interface{}) { Infof(format, v...) }
 
+func (*Logger) Infow(msg string, kv ...interface{}) { Infow(msg, kv...) }
+
 func (*Logger) Debug(v ...interface{}) { Debug(v...) }
 
 func (*Logger) Debugf(format string, v ...interface{}) { Debugf(format, v...) }
 
+func (*Logger) Debugw(msg string, kv ...interface{}) { Debugw(msg, kv...) }
+
 func (*Logger) Warn(v ...interface{}) { Warn(v...) }
 
 func (*Logger) Warnf(format string, v ...interface{}) { Warnf(format, v...) }
 
+func (*Logger) Warnw(msg string, kv ...interface{}) { Warnw(msg, kv...) }
+
 func (*Logger) Error(v ...interface{}) { Error(v...) }
 
 func (*Logger) Errorf(format string, v ...interface{}) { Errorf(format, v...) }
+
+func (*Logger) Errorw(msg string, kv ...interface{}) { Errorw(msg, kv...) }
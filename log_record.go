@@ -0,0 +1,62 @@
+package logs
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+//==============================Record==============================
+
+// Record 日志记录,在Entity.Printf/Print/Println中生成一次
+// 格式化和支持记录的输出都基于Record,不需要重复计算时间和调用位置
+type Record struct {
+	Time    time.Time       //时间
+	Level   Level           //日志等级,即实体的SelfLevel
+	Name    string          //实体名称,例如 "信息"
+	Tag     []string        //标签
+	File    string          //调用文件,完整路径
+	Line    int             //调用行号
+	Message string          //消息内容
+	Fields  []Field         //字段,包括context中提取的字段
+	Context context.Context //上下文,可能为nil
+	Entity  *Entity         //生成记录的实体
+}
+
+// Caller 调用位置,例 init_test.go:10
+func (this *Record) Caller() string {
+	if len(this.File) == 0 {
+		return ""
+	}
+	return filepath.Base(this.File) + ":" + strconv.Itoa(this.Line)
+}
+
+// IRecordWriter 支持日志记录的输出,p是格式化后的数据
+type IRecordWriter interface {
+	WriteRecord(r *Record, p []byte) (int, error)
+}
+
+// newRecord 生成日志记录,skip为调用newRecord的函数到对外函数的层级,
+// 例如在Print中调用传1,定位到调用Print的位置
+func (this *Entity) newRecord(skip int, msg string) *Record {
+	r := &Record{
+		Time:    time.Now(),
+		Level:   this.SelfLevel,
+		Name:    this.Name,
+		Tag:     this.Tag,
+		Message: msg,
+		Fields:  this.Fields,
+		Context: this.ctx,
+		Entity:  this,
+	}
+	if fields := extractContext(this.ctx); len(fields) > 0 {
+		r.Fields = append(fields, this.Fields...)
+	}
+	_, file, line, ok := runtime.Caller(skip + 1 + this.caller + this.callerBase)
+	if ok {
+		r.File, r.Line = file, line
+	}
+	return r
+}
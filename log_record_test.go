@@ -0,0 +1,85 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type recordWriter struct {
+	records []*Record
+	bytes.Buffer
+}
+
+func (this *recordWriter) WriteRecord(r *Record, p []byte) (int, error) {
+	this.records = append(this.records, r)
+	return this.Write(p)
+}
+
+func TestRecordWriter(t *testing.T) {
+	w := &recordWriter{}
+	e := NewEntity("测试").SetWriter(w).SetShowColor(false)
+	e.With("id", 1).Println("hello")
+	e.Write([]byte("raw\n"))
+	if len(w.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(w.records))
+	}
+	r := w.records[0]
+	if r.Message != "hello\n" || r.Name != "测试" || len(r.Fields) != 1 {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	if !strings.HasPrefix(r.Caller(), "log_record_test.go:") {
+		t.Fatalf("unexpected caller: %s", r.Caller())
+	}
+	if !strings.Contains(w.String(), r.Caller()+": hello id=1\n") {
+		t.Fatalf("unexpected output: %q", w.String())
+	}
+}
+
+func TestFormatFunc(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false)
+	e.SetFormatter(FormatFunc(func(e *Entity, msg string) string {
+		return "[Format] " + msg
+	}))
+	e.Println("hello")
+	if buf.String() != "[Format] hello\n" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+// legacyFormatter 只实现IFormatter的格式化,通过e.GetCaller获取调用位置
+type legacyFormatter struct{}
+
+func (legacyFormatter) Formatter(e *Entity, msg string) string {
+	buf := bytes.NewBuffer(nil)
+	log.New(buf, "[legacy] ", log.Lshortfile).Output(e.GetCaller(), msg)
+	return buf.String()
+}
+
+func TestLegacyFormatter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false).SetFormatter(legacyFormatter{})
+	_, _, line, _ := runtime.Caller(0)
+	e.Println("hello")
+	if want := fmt.Sprintf("[legacy] log_record_test.go:%d: hello\n", line+1); buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestFJsonCompatible(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	var f FormatFunc = FJson
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false).SetFormatter(f)
+	_, _, line, _ := runtime.Caller(0)
+	e.Println("hello")
+	if want := fmt.Sprintf(`"caller":"log_record_test.go:%d"`, line+1); !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %s, got %q", want, buf.String())
+	}
+	if s := FJson(e, "direct"); !strings.Contains(s, `"msg":"direct"`) {
+		t.Fatalf("unexpected output: %q", s)
+	}
+}
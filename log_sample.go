@@ -0,0 +1,134 @@
+package logs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+//==============================Sample==============================
+
+// newLimiter 采样和限流,默认都不开启
+func newLimiter(e *Entity) *limiter {
+	return &limiter{entity: e, counts: map[uint32]int{}}
+}
+
+// limiter 采样和限流,被抑制的日志数量会在周期结束时汇总输出一条
+type limiter struct {
+	entity *Entity //输出汇总的实体
+
+	//采样,每个周期内相同的消息先输出first条,之后每thereafter条输出1条
+	tick       time.Duration
+	first      int
+	thereafter int
+	counts     map[uint32]int //每个消息的数量
+	tickStart  time.Time      //当前周期的开始时间
+
+	//令牌桶限流,每秒rate个令牌,最多burst个
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+
+	suppressed      int64       //被抑制的数量
+	suppressedTimer *time.Timer //汇总定时器
+	mu              sync.Mutex
+}
+
+func (this *limiter) setSample(tick time.Duration, first, thereafter int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if tick <= 0 {
+		tick = time.Second
+	}
+	this.tick, this.first, this.thereafter = tick, first, thereafter
+	this.counts = map[uint32]int{}
+	this.tickStart = time.Time{}
+}
+
+func (this *limiter) setRateLimit(rate float64, burst int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	this.rate, this.burst = rate, burst
+	this.tokens, this.last = float64(burst), time.Time{}
+}
+
+// allow 判断是否输出,不输出的计入抑制数量
+func (this *limiter) allow(msg string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.first <= 0 && this.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	if this.sample(now, msg) && this.take(now) {
+		return true
+	}
+	this.suppressed++
+	if this.suppressedTimer == nil {
+		interval := this.tick
+		if interval <= 0 {
+			interval = time.Second
+		}
+		this.suppressedTimer = time.AfterFunc(interval, this.report)
+	}
+	return false
+}
+
+// sample 采样判断,参考zap的sampler
+func (this *limiter) sample(now time.Time, msg string) bool {
+	if this.first <= 0 {
+		return true
+	}
+	if now.Sub(this.tickStart) >= this.tick {
+		this.tickStart = now
+		this.counts = map[uint32]int{}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(msg))
+	key := h.Sum32()
+	this.counts[key]++
+	n := this.counts[key]
+	if n <= this.first {
+		return true
+	}
+	return this.thereafter > 0 && (n-this.first)%this.thereafter == 0
+}
+
+// take 令牌桶取令牌
+func (this *limiter) take(now time.Time) bool {
+	if this.rate <= 0 {
+		return true
+	}
+	if !this.last.IsZero() {
+		this.tokens += now.Sub(this.last).Seconds() * this.rate
+		if this.tokens > float64(this.burst) {
+			this.tokens = float64(this.burst)
+		}
+	}
+	this.last = now
+	if this.tokens < 1 {
+		return false
+	}
+	this.tokens--
+	return true
+}
+
+// report 输出汇总,例 [logs] 1024 messages suppressed
+func (this *limiter) report() {
+	this.mu.Lock()
+	n := this.suppressed
+	this.suppressed = 0
+	this.suppressedTimer = nil
+	this.mu.Unlock()
+	if n > 0 {
+		e := this.entity
+		r := e.newRecord(0, fmt.Sprintf("[logs] %d messages suppressed\n", n))
+		r.File, r.Line = "", 0
+		e.WriteRecord(r, []byte(formatRecord(e.getFormatter(), r)))
+	}
+}
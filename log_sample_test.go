@@ -0,0 +1,52 @@
+package logs
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (this *syncBuffer) Write(p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.Buffer.Write(p)
+}
+
+func (this *syncBuffer) Count(s string) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return bytes.Count(this.Bytes(), []byte(s))
+}
+
+func TestSample(t *testing.T) {
+	buf := &syncBuffer{}
+	e := NewEntity("测试").SetWriter(buf).SetShowColor(false)
+	e.SetSample(time.Millisecond*50, 2, 3)
+	for i := 0; i < 10; i++ {
+		e.Println("same")
+	}
+	e.Println("other")
+	if n := buf.Count("same"); n != 4 {
+		t.Fatalf("expected 4 sampled lines, got %d", n)
+	}
+	<-time.After(time.Millisecond * 100)
+	if n := buf.Count("[logs] 6 messages suppressed"); n != 1 {
+		t.Fatalf("expected suppressed summary: %q", buf.String())
+	}
+
+	buf.Reset()
+	e.SetSample(0, 0, 0).SetRateLimit(1, 3)
+	for i := 0; i < 10; i++ {
+		e.Println("limit")
+	}
+	if n := buf.Count("limit"); n != 3 {
+		t.Fatalf("expected 3 lines, got %d", n)
+	}
+	e.SetRateLimit(0, 0)
+}
@@ -0,0 +1,137 @@
+//go:build go1.21
+// +build go1.21
+
+package logs
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+)
+
+//==============================Slog==============================
+
+// NewSlogHandler 新建slog.Handler,日志写入到预设的实体,
+// 使用实体的输出,颜色,格式和等级,例 slog.New(logs.NewSlogHandler())
+func NewSlogHandler() *SlogHandler {
+	return &SlogHandler{}
+}
+
+// SlogHandler 实现slog.Handler,slog等级映射到 LevelDebug/LevelInfo/LevelWarn/LevelError 的实体,
+// 属性和分组转成字段,分组使用"."连接,例 req.id=1
+type SlogHandler struct {
+	// Entity 自定义等级对应的实体,为nil时使用 DefaultDebug/DefaultInfo/DefaultWarn/DefaultErr
+	Entity func(level slog.Level) *Entity
+
+	fields []Field  //WithAttrs添加的字段
+	groups []string //WithGroup添加的分组
+}
+
+func (this *SlogHandler) entity(level slog.Level) *Entity {
+	if this.Entity != nil {
+		if e := this.Entity(level); e != nil {
+			return e
+		}
+	}
+	switch {
+	case level < slog.LevelInfo:
+		return DefaultDebug
+	case level < slog.LevelWarn:
+		return DefaultInfo
+	case level < slog.LevelError:
+		return DefaultWarn
+	default:
+		return DefaultErr
+	}
+}
+
+// Enabled 实现slog.Handler,和实体的等级判断保持一致
+func (this *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	e := this.entity(level)
+	return e.Level <= e.SelfLevel
+}
+
+// Handle 实现slog.Handler
+func (this *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := this.entity(r.Level)
+	if e.Level > e.SelfLevel {
+		return nil
+	}
+	fields := make([]Field, 0, len(this.fields)+r.NumAttrs())
+	fields = append(fields, this.fields...)
+	prefix := this.prefix()
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, prefix, a)
+		return true
+	})
+
+	record := e.WithContext(ctx).With(fields).newRecord(0, r.Message+"\n")
+	if !r.Time.IsZero() {
+		record.Time = r.Time
+	}
+	record.File, record.Line = "", 0
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		record.File, record.Line = frame.File, frame.Line
+	}
+	if !e.allow(record) {
+		return nil
+	}
+	_, err := e.WriteRecord(record, []byte(formatRecord(e.getFormatter(), record)))
+	return err
+}
+
+// WithAttrs 实现slog.Handler
+func (this *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return this
+	}
+	h := *this
+	h.fields = make([]Field, 0, len(this.fields)+len(attrs))
+	h.fields = append(h.fields, this.fields...)
+	prefix := this.prefix()
+	for _, a := range attrs {
+		h.fields = appendAttr(h.fields, prefix, a)
+	}
+	return &h
+}
+
+// WithGroup 实现slog.Handler
+func (this *SlogHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return this
+	}
+	h := *this
+	h.groups = append(this.groups[:len(this.groups):len(this.groups)], name)
+	return &h
+}
+
+func (this *SlogHandler) prefix() string {
+	if len(this.groups) == 0 {
+		return ""
+	}
+	return strings.Join(this.groups, ".") + "."
+}
+
+// appendAttr 属性转成字段,分组展开成 group.key
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if len(a.Key) > 0 {
+			prefix += a.Key + "."
+		}
+		for _, v := range attrs {
+			fields = appendAttr(fields, prefix, v)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
@@ -0,0 +1,37 @@
+//go:build go1.21
+// +build go1.21
+
+package logs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	info := NewEntity("信息").SetWriter(buf).SetShowColor(false).SetSelfLevel(LevelInfo)
+	debug := NewEntity("调试").SetWriter(buf).SetShowColor(false).SetSelfLevel(LevelDebug).SetLevel(LevelInfo)
+	h := NewSlogHandler()
+	h.Entity = func(level slog.Level) *Entity {
+		if level < slog.LevelInfo {
+			return debug
+		}
+		return info
+	}
+
+	log := slog.New(h).With("app", "test").WithGroup("req")
+	log.Info("hello", "id", 1, slog.Group("user", "name", "a"))
+	if got := buf.String(); !strings.HasPrefix(got, "[信息] ") ||
+		!strings.HasSuffix(got, "log_slog_test.go:26: hello app=test req.id=1 req.user.name=a\n") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+
+	buf.Reset()
+	log.Debug("ignored")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
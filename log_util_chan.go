@@ -2,50 +2,221 @@ package logs
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
 )
 
+// DropReportInterval 队列丢弃数据后,间隔多久输出一条"N messages dropped"的提示
+var DropReportInterval = time.Second * 10
+
 func newChan(ctx context.Context, cap int) *Chan {
+	ctx, cancel := context.WithCancel(ctx)
 	data := &Chan{
-		c:   make(chan []byte, cap),
-		ctx: ctx,
+		c:      make(chan *chanItem, cap),
+		policy: OverflowDropNewest,
+		ctx:    ctx,
+		cancel: cancel,
 	}
+	register(data)
 	go data.run(ctx)
 	return data
 }
 
+// chanItem 队列数据,记录可能为nil(直接写入字节的情况)
+type chanItem struct {
+	r *Record
+	p []byte
+}
+
+// ChanStats 队列统计
+type ChanStats struct {
+	Enqueued  int64 //加入队列的数量
+	Delivered int64 //处理完成的数量
+	Dropped   int64 //丢弃的数量
+}
+
 type Chan struct {
-	c       chan []byte                                     //通道
-	handler func(ctx context.Context, count int, bs []byte) //数据处理
+	pending   int64 //未处理完成的数量
+	enqueued  int64 //加入队列的数量
+	delivered int64 //处理完成的数量
+	dropped   int64 //丢弃的数量
+	reported  int64 //已经提示过的丢弃数量
+	reporting bool  //正在输出丢弃的提示,提示本身被丢弃时不再计数
+
+	c       chan *chanItem                                             //通道
+	handler func(ctx context.Context, count int, r *Record, bs []byte) //数据处理
+	closer  func() error                                               //关闭时执行,例如关闭连接
+	policy  OverflowPolicy                                             //队列满了之后的处理方式
+	timeout time.Duration                                              //阻塞的最长时间,0为一直阻塞
 	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// SetOverflow 设置队列满了之后的处理方式,默认丢弃最新的数据,
+// timeout 为 OverflowBlock 的最长等待时间,超时则丢弃,默认一直等待
+func (this *Chan) SetOverflow(policy OverflowPolicy, timeout ...time.Duration) *Chan {
+	this.policy = policy
+	this.timeout = 0
+	if len(timeout) > 0 {
+		this.timeout = timeout[0]
+	}
+	return this
+}
+
+// Stats 获取队列统计
+func (this *Chan) Stats() ChanStats {
+	return ChanStats{
+		Enqueued:  atomic.LoadInt64(&this.enqueued),
+		Delivered: atomic.LoadInt64(&this.delivered),
+		Dropped:   atomic.LoadInt64(&this.dropped),
+	}
 }
 
 func (this *Chan) Write(p []byte) (int, error) {
-	return len(p), this.Try(p)
+	if err := this.Try(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-// Try 尝试加入队列(如果满了则忽略)
+// WriteRecord 实现IRecordWriter,记录和数据一起加入队列
+func (this *Chan) WriteRecord(r *Record, p []byte) (int, error) {
+	if err := this.try(&chanItem{r: r, p: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Try 尝试加入队列,队列满了按照设置的策略处理,丢弃返回ErrQueueFull,已关闭返回ErrClosed
 func (this *Chan) Try(data ...[]byte) error {
 	for _, v := range data {
+		if err := this.try(&chanItem{p: v}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *Chan) try(item *chanItem) error {
+	if this.ctx.Err() != nil {
+		return ErrClosed
+	}
+	atomic.AddInt64(&this.pending, 1)
+	if err := this.push(item); err != nil {
+		atomic.AddInt64(&this.pending, -1)
+		if err == ErrQueueFull {
+			atomic.AddInt64(&this.dropped, 1)
+		}
+		return err
+	}
+	atomic.AddInt64(&this.enqueued, 1)
+	return nil
+}
+
+func (this *Chan) push(item *chanItem) error {
+	for {
 		select {
-		case <-this.ctx.Done():
+		case this.c <- item:
 			return nil
-		case this.c <- v:
+		default:
+		}
+
+		switch this.policy {
+		case OverflowDropOldest:
+			select {
+			case <-this.c:
+				atomic.AddInt64(&this.pending, -1)
+				atomic.AddInt64(&this.dropped, 1)
+			default:
+			}
+
+		case OverflowBlock:
+			var timeout <-chan time.Time
+			if this.timeout > 0 {
+				t := time.NewTimer(this.timeout)
+				defer t.Stop()
+				timeout = t.C
+			}
+			select {
+			case this.c <- item:
+				return nil
+			case <-this.ctx.Done():
+				return ErrClosed
+			case <-timeout:
+				return ErrQueueFull
+			}
+
 		default:
 			//尝试加入队列失败
+			return ErrQueueFull
 		}
 	}
+}
+
+// queued 队列中未处理完成的数量
+func (this *Chan) queued() int64 {
+	if this.ctx.Err() != nil {
+		return 0
+	}
+	return atomic.LoadInt64(&this.pending)
+}
+
+// Flush 等待队列中的数据处理完成
+func (this *Chan) Flush(timeout time.Duration) error {
+	return waitFlush(timeout, func() bool {
+		return atomic.LoadInt64(&this.pending) <= 0 || this.ctx.Err() != nil
+	})
+}
+
+// Close 关闭队列,不再处理数据,需要先处理完的话先执行Flush
+func (this *Chan) Close() error {
+	if this.ctx.Err() != nil {
+		return nil
+	}
+	unregister(this)
+	this.cancel()
+	if this.closer != nil {
+		return this.closer()
+	}
 	return nil
 }
 
+// reportDropped 有新的丢弃数据时,输出一条提示到数据流中
+func (this *Chan) reportDropped(ctx context.Context, count int) {
+	dropped := atomic.LoadInt64(&this.dropped)
+	n := dropped - atomic.LoadInt64(&this.reported)
+	if n <= 0 || this.handler == nil {
+		return
+	}
+	atomic.StoreInt64(&this.reported, dropped)
+	this.reporting = true
+	defer func() { this.reporting = false }()
+	this.handler(ctx, count, nil, []byte(fmt.Sprintf("[logs] %d messages dropped\n", n)))
+}
+
+// drop 处理函数丢弃了数据(例如未连接),计入丢弃的数量,只能在处理函数中调用
+func (this *Chan) drop() {
+	if !this.reporting {
+		atomic.AddInt64(&this.dropped, 1)
+	}
+}
+
 func (this *Chan) run(ctx context.Context) {
+	ticker := time.NewTicker(DropReportInterval)
+	defer ticker.Stop()
 	for i := 0; ; i++ {
 		select {
 		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			this.reportDropped(ctx, i)
 		case v := <-this.c:
 			if this.handler != nil {
-				this.handler(ctx, i, v)
+				this.handler(ctx, i, v.r, v.p)
 			}
+			atomic.AddInt64(&this.delivered, 1)
+			atomic.AddInt64(&this.pending, -1)
 		}
 	}
 }
@@ -0,0 +1,54 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChanOverflow(t *testing.T) {
+	block := make(chan struct{})
+	var got []string
+	c := newChan(context.Background(), 2)
+	defer c.Close()
+	c.handler = func(ctx context.Context, count int, r *Record, bs []byte) {
+		<-block
+		got = append(got, string(bs))
+	}
+	c.SetOverflow(OverflowDropOldest)
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		if err := c.Try([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(block)
+	if err := c.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stats := c.Stats()
+	if stats.Enqueued != 5 || stats.Delivered+stats.Dropped != 5 || stats.Dropped == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if last := got[len(got)-1]; last != "5" {
+		t.Fatalf("newest message dropped: %v", got)
+	}
+
+	c.reportDropped(c.ctx, 0)
+	if last := got[len(got)-1]; !strings.Contains(last, "messages dropped") {
+		t.Fatalf("expected dropped report: %v", got)
+	}
+
+	c.SetOverflow(OverflowBlock, time.Millisecond*10)
+	block = make(chan struct{})
+	defer close(block)
+	c.handler = func(ctx context.Context, count int, r *Record, bs []byte) { <-block }
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = c.Try([]byte("x"))
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
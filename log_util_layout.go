@@ -0,0 +1,229 @@
+package logs
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+	解析时间格式(例如文件名 "./output/logs/2006-01-02/{type}_15.log"),
+	和标准库time的格式解析保持一致,用于匹配生成的文件和判断时间粒度
+
+*/
+
+// layoutUnit 时间格式的粒度
+type layoutUnit int
+
+const (
+	unitNone layoutUnit = iota
+	unitYear
+	unitMonth
+	unitDay
+	unitHour
+	unitMinute
+	unitSecond
+)
+
+// layoutChunk 时间格式的片段,std为空时是普通文本
+type layoutChunk struct {
+	text string     //原始文本
+	std  string     //时间格式对应的正则,为空则是普通文本
+	unit layoutUnit //时间粒度
+}
+
+const (
+	regNum1or2 = `\d{1,2}`
+	regNum2    = `\d{2}`
+	regWord    = `[A-Za-z]+`
+	regZone    = `(Z|[+-][\d:]+)`
+)
+
+// parseLayout 按照标准库time的规则拆分时间格式
+func parseLayout(layout string) []layoutChunk {
+	var chunks []layoutChunk
+	for len(layout) > 0 {
+		prefix, std, suffix := nextLayoutChunk(layout)
+		if len(prefix) > 0 {
+			chunks = append(chunks, layoutChunk{text: prefix})
+		}
+		if len(std.text) == 0 {
+			break
+		}
+		chunks = append(chunks, std)
+		layout = suffix
+	}
+	return chunks
+}
+
+// layoutUnitOf 时间格式中最小的时间粒度
+func layoutUnitOf(layout string) layoutUnit {
+	unit := unitNone
+	for _, v := range parseLayout(layout) {
+		if v.unit > unit {
+			unit = v.unit
+		}
+	}
+	return unit
+}
+
+// layoutRegexp 时间格式转成正则(不含首尾限定)
+func layoutRegexp(layout string) string {
+	var b strings.Builder
+	for _, v := range parseLayout(layout) {
+		if len(v.std) > 0 {
+			b.WriteString(v.std)
+		} else {
+			b.WriteString(regexp.QuoteMeta(v.text))
+		}
+	}
+	return b.String()
+}
+
+// hasLayout 是否包含时间格式
+func hasLayout(s string) bool {
+	for _, v := range parseLayout(s) {
+		if len(v.std) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLayoutChunk 参考标准库time.nextStdChunk
+func nextLayoutChunk(layout string) (prefix string, std layoutChunk, suffix string) {
+	chunk := func(i, n int, reg string, unit layoutUnit) (string, layoutChunk, string) {
+		return layout[:i], layoutChunk{text: layout[i : i+n], std: reg, unit: unit}, layout[i+n:]
+	}
+	for i := 0; i < len(layout); i++ {
+		switch c := layout[i]; c {
+		case 'J': // January, Jan
+			if strings.HasPrefix(layout[i:], "Jan") {
+				if strings.HasPrefix(layout[i:], "January") {
+					return chunk(i, 7, regWord, unitMonth)
+				}
+				if !startsWithLower(layout[i+3:]) {
+					return chunk(i, 3, regWord, unitMonth)
+				}
+			}
+		case 'M': // Monday, Mon, MST
+			if strings.HasPrefix(layout[i:], "Mon") {
+				if strings.HasPrefix(layout[i:], "Monday") {
+					return chunk(i, 6, regWord, unitDay)
+				}
+				if !startsWithLower(layout[i+3:]) {
+					return chunk(i, 3, regWord, unitDay)
+				}
+			}
+			if strings.HasPrefix(layout[i:], "MST") {
+				return chunk(i, 3, `[A-Za-z0-9+-]+`, unitNone)
+			}
+		case '0': // 01, 02, 03, 04, 05, 06, 002
+			if i+1 < len(layout) && '1' <= layout[i+1] && layout[i+1] <= '6' {
+				unit := [...]layoutUnit{unitMonth, unitDay, unitHour, unitMinute, unitSecond, unitYear}[layout[i+1]-'1']
+				return chunk(i, 2, regNum2, unit)
+			}
+			if strings.HasPrefix(layout[i:], "002") {
+				return chunk(i, 3, `\d{3}`, unitDay)
+			}
+		case '1': // 15, 1
+			if i+1 < len(layout) && layout[i+1] == '5' {
+				return chunk(i, 2, regNum2, unitHour)
+			}
+			return chunk(i, 1, regNum1or2, unitMonth)
+		case '2': // 2006, 2
+			if strings.HasPrefix(layout[i:], "2006") {
+				return chunk(i, 4, `\d{4}`, unitYear)
+			}
+			return chunk(i, 1, regNum1or2, unitDay)
+		case '_': // _2, _2006, __2
+			if i+1 < len(layout) && layout[i+1] == '2' {
+				//_2006 是普通的_加上年份
+				if strings.HasPrefix(layout[i+1:], "2006") {
+					return chunk(i+1, 4, `\d{4}`, unitYear)
+				}
+				return chunk(i, 2, `[ \d]\d`, unitDay)
+			}
+			if strings.HasPrefix(layout[i:], "__2") {
+				return chunk(i, 3, `[ \d]{2}\d`, unitDay)
+			}
+		case '3':
+			return chunk(i, 1, regNum1or2, unitHour)
+		case '4':
+			return chunk(i, 1, regNum1or2, unitMinute)
+		case '5':
+			return chunk(i, 1, regNum1or2, unitSecond)
+		case 'P': // PM
+			if i+1 < len(layout) && layout[i+1] == 'M' {
+				return chunk(i, 2, `(AM|PM)`, unitNone)
+			}
+		case 'p': // pm
+			if i+1 < len(layout) && layout[i+1] == 'm' {
+				return chunk(i, 2, `(am|pm)`, unitNone)
+			}
+		case '-', 'Z': // -070000, -07:00:00, -0700, -07:00, -07, Z开头同理
+			for _, v := range []string{"070000", "07:00:00", "0700", "07:00", "07"} {
+				if strings.HasPrefix(layout[i+1:], v) {
+					return chunk(i, len(v)+1, regZone, unitNone)
+				}
+			}
+		case '.', ',': // .000, .999, ,000, ,999 秒的小数部分
+			if i+1 < len(layout) && (layout[i+1] == '0' || layout[i+1] == '9') {
+				j := i + 1
+				for j < len(layout) && layout[j] == layout[i+1] {
+					j++
+				}
+				if !(j < len(layout) && '0' <= layout[j] && layout[j] <= '9') {
+					return chunk(i, j-i, `([.,]\d*)?`, unitSecond)
+				}
+			}
+		}
+	}
+	return layout, layoutChunk{}, ""
+}
+
+func startsWithLower(s string) bool {
+	return len(s) > 0 && 'a' <= s[0] && s[0] <= 'z'
+}
+
+// placeholderRune 占位符替换成私有区字符,避免占位符的值(例如进程号)被当成时间格式
+const placeholderRune = '\uE000'
+
+// protectLayout 把 {key} 占位符替换成私有区字符,返回替换后的格式和占位符的值,
+// lookup返回false的占位符保持不变
+func protectLayout(layout string, lookup func(key string) (string, bool)) (string, []string) {
+	var b strings.Builder
+	var values []string
+	for {
+		i := strings.Index(layout, "{")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(layout[i:], "}")
+		if j < 0 {
+			break
+		}
+		v, ok := lookup(layout[i+1 : i+j])
+		if !ok {
+			b.WriteString(layout[:i+1])
+			layout = layout[i+1:]
+			continue
+		}
+		b.WriteString(layout[:i])
+		b.WriteRune(placeholderRune + rune(len(values)))
+		values = append(values, v)
+		layout = layout[i+j+1:]
+	}
+	b.WriteString(layout)
+	return b.String(), values
+}
+
+// restoreLayout 把私有区字符还原成占位符的值,fn用于转换值,例如regexp.QuoteMeta
+func restoreLayout(s string, values []string, fn func(string) string) string {
+	for i, v := range values {
+		if fn != nil {
+			v = fn(v)
+		}
+		s = strings.ReplaceAll(s, string(placeholderRune+rune(i)), v)
+	}
+	return s
+}
@@ -0,0 +1,325 @@
+package logs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//==============================Spool==============================
+
+var (
+	// SpoolSegmentSize 磁盘队列单个分段文件的大小
+	SpoolSegmentSize int64 = 4 << 20
+
+	// SpoolRetryInterval 远端不可用时,重新发送磁盘队列的间隔
+	SpoolRetryInterval = time.Second
+)
+
+const (
+	spoolExt        = ".seg"   //分段文件的后缀
+	spoolOffsetName = "offset" //记录读取位置的文件
+)
+
+// NewSpool 新建磁盘队列,dir为分段文件的目录,maxSize为所有分段的最大大小,超出删除最旧的分段,
+// 目录中已有的数据(例如重启前未发送的)会继续发送,一个磁盘队列只能给一个输出使用
+func NewSpool(dir string, maxSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	offset, err := os.OpenFile(filepath.Join(dir, spoolOffsetName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		offset:  offset,
+		sizes:   map[int64]int64{},
+		stop:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		offset.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Spool 磁盘队列,远端不可用时暂存数据(帧格式,参考Frame),恢复后按顺序重新发送
+type Spool struct {
+	dir     string
+	maxSize int64
+
+	segments []int64         //分段序号,从旧到新,最后一个是写入的分段
+	sizes    map[int64]int64 //分段大小
+	size     int64           //所有分段的大小
+	w        *os.File        //写入的分段
+	r        *os.File        //读取的分段(第一个)
+	rOffset  int64           //读取的位置
+	offset   *os.File        //记录读取的分段和位置,重启后继续
+
+	owner   io.Writer                //使用队列的输出,用于输出错误
+	send    func(frame []byte) error //发送数据
+	failing bool                     //远端是否不可用
+	closed  bool                     //是否已经关闭
+	mu      sync.Mutex
+	stop    chan struct{}
+}
+
+func (this *Spool) segName(seq int64) string {
+	return filepath.Join(this.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+// load 加载已有的分段和读取位置,并新建一个写入的分段,避免在可能写了一半的分段后面继续写入
+func (this *Spool) load() error {
+	infos, err := ioutil.ReadDir(this.dir)
+	if err != nil {
+		return err
+	}
+	for _, v := range infos {
+		name := v.Name()
+		if v.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		this.segments = append(this.segments, seq)
+		this.sizes[seq] = v.Size()
+	}
+	sort.Slice(this.segments, func(i, j int) bool { return this.segments[i] < this.segments[j] })
+
+	//读取位置之前的分段已经发送完成
+	var seq, offset int64
+	bs := make([]byte, 64)
+	n, _ := this.offset.ReadAt(bs, 0)
+	fmt.Sscanf(string(bs[:n]), "%d %d", &seq, &offset)
+	for len(this.segments) > 0 && this.segments[0] < seq {
+		this.removeHead()
+	}
+	if len(this.segments) > 0 && this.segments[0] == seq {
+		this.rOffset = offset
+	}
+	for _, v := range this.segments {
+		this.size += this.sizes[v]
+	}
+
+	next := int64(1)
+	if len(this.segments) > 0 {
+		next = this.segments[len(this.segments)-1] + 1
+	}
+	return this.newSegment(next)
+}
+
+// newSegment 新建写入的分段
+func (this *Spool) newSegment(seq int64) error {
+	f, err := os.OpenFile(this.segName(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if this.w != nil {
+		this.w.Close()
+	}
+	this.w = f
+	this.segments = append(this.segments, seq)
+	this.sizes[seq] = 0
+	return nil
+}
+
+// removeHead 删除第一个分段
+func (this *Spool) removeHead() {
+	seq := this.segments[0]
+	if this.r != nil {
+		this.r.Close()
+		this.r = nil
+	}
+	os.Remove(this.segName(seq))
+	this.size -= this.sizes[seq]
+	delete(this.sizes, seq)
+	this.segments = this.segments[1:]
+	this.rOffset = 0
+}
+
+// push 数据加入队列,超出最大大小时删除最旧的分段
+func (this *Spool) push(frame []byte) error {
+	seq := this.segments[len(this.segments)-1]
+	if this.sizes[seq] >= SpoolSegmentSize {
+		if err := this.newSegment(seq + 1); err != nil {
+			return err
+		}
+		seq++
+	}
+	n, err := this.w.Write(frame)
+	this.sizes[seq] += int64(n)
+	this.size += int64(n)
+	for this.maxSize > 0 && this.size > this.maxSize && len(this.segments) > 1 {
+		reportError(nil, this.owner, fmt.Errorf("spool full, dropped %d bytes", this.sizes[this.segments[0]]-this.rOffset))
+		this.removeHead()
+	}
+	return err
+}
+
+// empty 队列是否为空
+func (this *Spool) empty() bool {
+	return len(this.segments) == 1 && this.rOffset >= this.sizes[this.segments[0]]
+}
+
+// front 读取第一帧数据(不移除),读完的分段会被删除,队列为空返回io.EOF
+func (this *Spool) front() ([]byte, error) {
+	for {
+		if this.empty() {
+			return nil, io.EOF
+		}
+		seq := this.segments[0]
+		if this.r == nil {
+			f, err := os.Open(this.segName(seq))
+			if err != nil {
+				return nil, err
+			}
+			this.r = f
+		}
+		frame, err := readFrameAt(this.r, this.rOffset)
+		if err == nil {
+			return frame, nil
+		}
+		if len(this.segments) == 1 {
+			//写入的分段没有完整的帧,等待写入
+			return nil, io.EOF
+		}
+		//读完或者数据不完整(例如异常退出),删除该分段
+		this.removeHead()
+		this.saveOffset()
+	}
+}
+
+// pop 移除第一帧数据,并记录读取位置
+func (this *Spool) pop(n int) {
+	this.rOffset += int64(n)
+	this.saveOffset()
+}
+
+func (this *Spool) saveOffset() {
+	if len(this.segments) > 0 {
+		this.offset.WriteAt([]byte(fmt.Sprintf("%020d %020d\n", this.segments[0], this.rOffset)), 0)
+	}
+}
+
+// readFrameAt 从指定位置读取一帧完整的数据(包含长度)
+func readFrameAt(r io.ReaderAt, offset int64) ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head, offset); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(head))
+	if size < frameHeadSize || size > MaxFrameSize {
+		return nil, fmt.Errorf("logs: invalid frame size %d", size)
+	}
+	frame := make([]byte, 4+size)
+	if _, err := r.ReadAt(frame, offset); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// drain 按顺序发送队列中的数据,返回队列是否已经发送完
+func (this *Spool) drain() bool {
+	for {
+		frame, err := this.front()
+		if err == io.EOF {
+			this.failing = false
+			return true
+		} else if err != nil {
+			reportError(nil, this.owner, err)
+			return false
+		}
+		if err := this.send(frame); err != nil {
+			this.fail(err)
+			return false
+		}
+		this.pop(len(frame))
+	}
+}
+
+// fail 远端不可用,只在状态变化时输出一次错误
+func (this *Spool) fail(err error) {
+	if !this.failing {
+		reportError(nil, this.owner, err)
+	}
+	this.failing = true
+}
+
+// deliver 发送数据,远端不可用或队列中还有数据时,加入队列,保证顺序
+func (this *Spool) deliver(frame []byte) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.closed {
+		reportError(nil, this.owner, ErrClosed)
+		return
+	}
+	if !this.failing && this.drain() {
+		err := this.send(frame)
+		if err == nil {
+			return
+		}
+		this.fail(err)
+	}
+	if err := this.push(frame); err != nil {
+		reportError(nil, this.owner, err)
+	}
+}
+
+// start 设置使用队列的输出和发送函数,并在后台定时重新发送队列中的数据
+func (this *Spool) start(owner io.Writer, send func(frame []byte) error) {
+	this.mu.Lock()
+	this.owner, this.send = owner, send
+	this.mu.Unlock()
+	ticker := time.NewTicker(SpoolRetryInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			this.mu.Lock()
+			if this.closed {
+				this.mu.Unlock()
+				return
+			}
+			if !this.empty() {
+				this.drain()
+			}
+			this.mu.Unlock()
+			select {
+			case <-this.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close 停止重新发送并关闭文件,未发送的数据保留在磁盘,下次启动继续发送
+func (this *Spool) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	close(this.stop)
+	if this.r != nil {
+		this.r.Close()
+		this.r = nil
+	}
+	if this.w != nil {
+		this.w.Close()
+		this.w = nil
+	}
+	return this.offset.Close()
+}
@@ -0,0 +1,105 @@
+package logs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spoolReceiver 模拟远端,down时发送失败
+type spoolReceiver struct {
+	mu   sync.Mutex
+	down bool
+	data []string
+}
+
+func (this *spoolReceiver) send(frame []byte) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.down {
+		return errors.New("down")
+	}
+	f, err := readFrame(bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	this.data = append(this.data, string(f.Data))
+	return nil
+}
+
+func (this *spoolReceiver) setDown(down bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.down = down
+}
+
+func (this *spoolReceiver) wait(t *testing.T, fn func(data []string) bool) []string {
+	for i := 0; i < 300; i++ {
+		this.mu.Lock()
+		data := append([]string(nil), this.data...)
+		this.mu.Unlock()
+		if fn(data) {
+			return data
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout waiting frames")
+	return nil
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	oldSegment, oldInterval, oldWriter := SpoolSegmentSize, SpoolRetryInterval, ErrorWriter
+	defer func() { SpoolSegmentSize, SpoolRetryInterval, ErrorWriter = oldSegment, oldInterval, oldWriter }()
+	SpoolSegmentSize, SpoolRetryInterval, ErrorWriter = 64, time.Millisecond*10, nil
+
+	//远端不可用时写入磁盘,关闭后保留
+	s, err := NewSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &spoolReceiver{down: true}
+	s.start(nil, rec.send)
+	for i := 0; i < 10; i++ {
+		s.deliver(encodeFrame(nil, []byte(fmt.Sprintf("line %d", i))))
+	}
+	s.Close()
+
+	//重启后按顺序发送
+	rec.setDown(false)
+	s, err = NewSpool(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.start(nil, rec.send)
+	rec.wait(t, func(data []string) bool { return len(data) == 10 })
+	s.deliver(encodeFrame(nil, []byte("line 10")))
+	data := rec.wait(t, func(data []string) bool { return len(data) == 11 })
+	for i, v := range data {
+		if want := fmt.Sprintf("line %d", i); v != want {
+			t.Fatalf("unexpected order at %d: %q", i, v)
+		}
+	}
+	s.Close()
+
+	//超出最大大小时丢弃最旧的数据
+	rec = &spoolReceiver{down: true}
+	s, err = NewSpool(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.start(nil, rec.send)
+	for i := 0; i < 20; i++ {
+		s.deliver(encodeFrame(nil, []byte(fmt.Sprintf("line %02d", i))))
+	}
+	rec.setDown(false)
+	s.deliver(encodeFrame(nil, []byte("line 20")))
+	data = rec.wait(t, func(data []string) bool { return len(data) > 0 && data[len(data)-1] == "line 20" })
+	if len(data) >= 20 {
+		t.Fatalf("unexpected data %v", data)
+	}
+}
@@ -14,12 +14,48 @@ import (
 
 */
 
-//==============================Stdout==============================
+//==============================Option==============================
+
+// WriterOption 单个输出的配置,通过 Entity.AddWriterWith 添加
+type WriterOption struct {
+	Level     Level      //最小日志等级,低于该等级的日志不输出,默认全部输出
+	Formatter IFormatter //格式化,为nil时使用实体的格式化
+}
+
+// optionWriter 带配置的输出
+type optionWriter struct {
+	io.Writer
+	WriterOption
+}
+
+// Color 是否支持颜色,和包装的输出保持一致
+func (this *optionWriter) Color() bool {
+	val, ok := this.Writer.(interface{ Color() bool })
+	return ok && val.Color()
+}
+
+// WriteRecord 如果包装的输出支持日志记录,则传递记录
+func (this *optionWriter) WriteRecord(r *Record, p []byte) (int, error) {
+	if w, ok := this.Writer.(IRecordWriter); ok {
+		return w.WriteRecord(r, p)
+	}
+	return this.Writer.Write(p)
+}
+
+//==============================Color==============================
 
 type writeColor struct{ io.Writer }
 
 func (this *writeColor) Color() bool { return true }
 
+// WriteRecord 如果包装的输出支持日志记录,则传递记录
+func (this *writeColor) WriteRecord(r *Record, p []byte) (int, error) {
+	if w, ok := this.Writer.(IRecordWriter); ok {
+		return w.WriteRecord(r, p)
+	}
+	return this.Writer.Write(p)
+}
+
 func NewWriteColor(writer io.Writer) io.Writer { return &writeColor{writer} }
 
 //==============================Stdout==============================
@@ -1,12 +1,14 @@
 package logs
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,19 +26,94 @@ func NewFile(filename string, maxSize ...int64) io.Writer {
 	return f
 }
 
+var (
+	// files 共享的文件,相同路径使用同一个File,保证分片和大小统计一致
+	files = sync.Map{}
+
+	// placeholders 文件名称的内置占位符,例 "./output/logs/{app}_{pid}.log"
+	placeholders = map[string]func() string{
+		"pid": func() string { return strconv.Itoa(os.Getpid()) },
+		"hostname": func() string {
+			name, _ := os.Hostname()
+			return name
+		},
+		"app": func() string {
+			name := filepath.Base(os.Args[0])
+			return strings.TrimSuffix(name, filepath.Ext(name))
+		},
+	}
+)
+
+// GetFile 获取共享的文件,相同路径(绝对路径)返回同一个File,
+// 多个实体写入同一个文件时使用,maxSize大于0时会更新最大文件大小
+func GetFile(filename string, maxSize ...int64) *File {
+	return getFile(filename, nil, maxSize...)
+}
+
+// getFile 获取共享的文件,values为文件名称占位符的值,占位符替换后的路径相同则共用
+func getFile(filename string, values map[string]string, maxSize ...int64) *File {
+	f := &File{Filename: filename, Values: values}
+	key, vs := protectLayout(filename, f.lookup)
+	key = restoreLayout(key, vs, nil)
+	if abs, err := filepath.Abs(key); err == nil {
+		key = abs
+	}
+	val, _ := files.LoadOrStore(key, f)
+	f = val.(*File)
+	if len(maxSize) > 0 && maxSize[0] > 0 {
+		f.mu.Lock()
+		f.MaxSize = maxSize[0]
+		f.mu.Unlock()
+	}
+	return f
+}
+
 // File 写入文件,自动打开关闭文件
 type File struct {
-	Filename string //日志名称
-	MaxSize  int64  //最大文件大小
+	Filename      string                       //日志名称,时间格式,支持占位符 {pid} {hostname} {app}
+	Values        map[string]string            //自定义占位符的值,例如 {"type": "信息"}
+	MaxSize       int64                        //最大文件大小
+	MaxAge        time.Duration                //文件最长保留时间,按修改时间,0为不限制
+	MaxBackups    int                          //最多保留的历史文件数量(不含当前文件),0为不限制
+	MaxTotalSize  int64                        //所有文件的最大总大小,超出删除最旧的文件,0为不限制
+	Compress      bool                         //是否gzip压缩写完的文件(时间或大小分片后),后台执行
+	BufferSize    int                          //写入缓存大小,0为不缓存,直接写入文件
+	FlushInterval time.Duration                //开启缓存时,定时写入并同步到磁盘的间隔,默认1秒
+	SyncOnError   bool                         //错误等级(LevelError)的日志立即写入并同步到磁盘
+	RotateEvery   time.Duration                //按时间分片的周期,例如6小时,默认按照文件名称中最小的时间粒度
+	Now           func() time.Time             //时钟,默认time.Now,方便测试
+	CheckInterval time.Duration                //检查文件是否被外部移动,删除或截断(logrotate)的间隔,0为不检查
+	Lock          bool                         //多进程写入相同的文件时开启,分片和写入时加文件锁(flock,仅linux)
+	MinFreeSpace  int64                        //磁盘最小剩余空间,低于时按照DiskFull处理,0为不检查
+	DiskFull      DiskFullPolicy               //磁盘空间不足时的处理方式,默认停止写入错误等级以下的日志
+	DiskNotify    *Entity                      //磁盘空间不足或恢复时输出提示的实体,默认写入ErrorWriter
+	FileMode      os.FileMode                  //新建文件的权限,默认0644
+	DirMode       os.FileMode                  //新建文件夹的权限,默认0755
+	Header        func(filename string) string //新建文件时写入的头部,例如版本,主机名,进程号和启动时间,为nil不写入
 
-	filename  string         //现在打开的文件名称
-	file      io.WriteCloser //文件流
-	filesize  int64          //当前文件大小
-	fileIndex int            //文件分片序号
+	filename  string              //现在打开的文件名称
+	file      *os.File            //文件流
+	buf       *bufio.Writer       //写入缓存,未开启缓存时为nil
+	stop      chan struct{}       //停止定时同步
+	filesize  int64               //当前文件大小
+	fileIndex int                 //文件分片序号
+	lastCheck time.Time           //上次检查文件是否被外部移动的时间
+	lockFile  *os.File            //跨进程的锁文件
+	diskLow   bool                //磁盘剩余空间是否不足
+	diskCheck time.Time           //上次检查磁盘剩余空间的时间
+	sealed    map[string]struct{} //正在压缩的文件,不再打开写入
 
 	lastOriginFilename string     //缓存上一次的文件名称
-	lastTime           time.Time  //缓存上一次的时间
+	lastLayout         string     //缓存上一次的文件名称格式
+	lastTime           time.Time  //缓存的时间周期开始时间
+	nextTime           time.Time  //缓存的时间周期结束时间
 	mu                 sync.Mutex //并发锁
+
+	cleaning    int32         //是否正在清理
+	cleanStop   chan struct{} //停止定时清理
+	filePattern *filePattern  //文件名称格式的解析结果
+	patternName string        //解析的文件名称格式
+	patternMu   sync.Mutex
 }
 
 func (this *File) addIndex(filename string, index int) string {
@@ -48,26 +125,112 @@ func (this *File) addIndex(filename string, index int) string {
 	return filepath.Join(filepath.Dir(filename), name[:len(name)-len(ext)]+"-"+strconv.Itoa(index)+ext)
 }
 
+// now 当前时间,可以通过Now注入时钟
+func (this *File) now() time.Time {
+	if this.Now != nil {
+		return this.Now()
+	}
+	return time.Now()
+}
+
+// getOriginFilename 按照时间生成文件名称,在同一个时间周期内使用缓存,
+// 周期按照RotateEvery,未设置则按照文件名称中最小的时间粒度,例如 "2006-01-02/15.log" 按小时
 func (this *File) getOriginFilename() string {
-	now := time.Now()
-	if now.Minute() == this.lastTime.Minute() &&
-		now.Hour() == this.lastTime.Hour() &&
-		now.Day() == this.lastTime.Day() {
+	now := this.now()
+	if this.lastLayout == this.Filename && !now.Before(this.lastTime) &&
+		(this.nextTime.IsZero() || now.Before(this.nextTime)) && len(this.lastOriginFilename) > 0 {
 		return this.lastOriginFilename
 	}
-	this.lastTime = now
-	this.lastOriginFilename = now.Format(this.Filename)
+	this.lastTime, this.nextTime = this.rotateBoundary(now)
+	this.lastLayout = this.Filename
+	layout, values := this.layout()
+	this.lastOriginFilename = restoreLayout(this.lastTime.Format(layout), values, nil)
 	return this.lastOriginFilename
 }
 
+// lookup 获取占位符的值,优先自定义的值
+func (this *File) lookup(key string) (string, bool) {
+	if v, ok := this.Values[key]; ok {
+		return v, true
+	}
+	if f, ok := placeholders[key]; ok {
+		return f(), true
+	}
+	return "", false
+}
+
+// layout 文件名称的时间格式,占位符替换成私有区字符,避免被当成时间格式
+func (this *File) layout() (string, []string) {
+	return protectLayout(this.Filename, this.lookup)
+}
+
+// rotateBoundary 时间所在周期的开始和结束时间,结束时间为零值表示不按时间分片
+func (this *File) rotateBoundary(t time.Time) (start, next time.Time) {
+	if this.RotateEvery > 0 {
+		//按照本地时间对齐,例如24小时从0点开始
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+		start = t.Add(shift).Truncate(this.RotateEvery).Add(-shift)
+		return start, start.Add(this.RotateEvery)
+	}
+	y, m, d := t.Date()
+	h, min, sec := t.Clock()
+	loc := t.Location()
+	layout, _ := this.layout()
+	switch layoutUnitOf(layout) {
+	case unitYear:
+		start = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0)
+	case unitMonth:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	case unitDay:
+		start = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	case unitHour:
+		start = time.Date(y, m, d, h, 0, 0, 0, loc)
+		return start, start.Add(time.Hour)
+	case unitMinute:
+		start = time.Date(y, m, d, h, min, 0, 0, loc)
+		return start, start.Add(time.Minute)
+	case unitSecond:
+		start = time.Date(y, m, d, h, min, sec, 0, loc)
+		return start, start.Add(time.Second)
+	default:
+		return t, time.Time{}
+	}
+}
+
+// fileMode 新建文件的权限
+func (this *File) fileMode() os.FileMode {
+	if this.FileMode == 0 {
+		return 0644
+	}
+	return this.FileMode
+}
+
+// dirMode 新建文件夹的权限
+func (this *File) dirMode() os.FileMode {
+	if this.DirMode == 0 {
+		return 0755
+	}
+	return this.DirMode
+}
+
 func (this *File) open(filename string) error {
-	//新建文件(如果不存在),添加至文件最后
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.ModeAppend|os.ModePerm)
+	//新建文件(如果不存在),添加至文件最后,O_EXCL判断是否是新建的文件,多进程时只有一个能新建成功
+	created := true
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, this.fileMode())
+	if os.IsExist(err) {
+		created = false
+		file, err = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, this.fileMode())
+	}
 	if err != nil {
 		return err
 	}
 	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return err
 	}
 
@@ -75,22 +238,149 @@ func (this *File) open(filename string) error {
 	this.filename = filename
 	this.file = file
 	this.filesize = info.Size()
+	if this.BufferSize > 0 {
+		this.buf = bufio.NewWriterSize(file, this.BufferSize)
+		this.stop = make(chan struct{})
+		go this.runSync(this.stop)
+	}
+
+	//新建的文件写入头部
+	if created && this.Header != nil {
+		if err := this.writeHeader(filename); err != nil {
+			reportError(nil, this, err)
+		}
+	}
+	register(this)
+	this.startClean()
+	if this.needClean() && this.cleanStop == nil && CleanInterval > 0 {
+		this.cleanStop = make(chan struct{})
+		go this.runClean(CleanInterval, this.cleanStop)
+	}
 	return nil
 }
 
+// writeHeader 写入文件头部,没有换行的自动补上
+func (this *File) writeHeader(filename string) error {
+	header := this.Header(filename)
+	if len(header) == 0 {
+		return nil
+	}
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	var w io.Writer = this.file
+	if this.buf != nil {
+		w = this.buf
+	}
+	n, err := io.WriteString(w, header)
+	this.filesize += int64(n)
+	return err
+}
+
 func (this *File) close() error {
 	if this.file != nil {
-		err := this.file.Close()
-		this.file = nil
+		err := this.flush()
+		if e := this.file.Close(); err == nil {
+			err = e
+		}
+		if this.stop != nil {
+			close(this.stop)
+			this.stop = nil
+		}
+		this.file, this.buf = nil, nil
 		return err
 	}
 	return nil
 }
 
+// flush 把缓存写入文件
+func (this *File) flush() error {
+	if this.buf != nil {
+		return this.buf.Flush()
+	}
+	return nil
+}
+
+// sync 把缓存写入文件并同步到磁盘
+func (this *File) sync() error {
+	if this.file == nil {
+		return nil
+	}
+	if err := this.flush(); err != nil {
+		return err
+	}
+	return this.file.Sync()
+}
+
+// runSync 定时把缓存写入文件并同步到磁盘
+func (this *File) runSync(stop chan struct{}) {
+	interval := this.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			this.mu.Lock()
+			if err := this.sync(); err != nil {
+				reportError(nil, this, err)
+			}
+			this.mu.Unlock()
+		}
+	}
+}
+
+// Sync 把缓存写入文件并同步到磁盘
+func (this *File) Sync() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.sync()
+}
+
+// Flush 实现刷新接口,把缓存写入文件并同步到磁盘
+func (this *File) Flush(timeout time.Duration) error {
+	return this.Sync()
+}
+
+// Close 写入缓存并关闭当前打开的文件,实现io.Closer,再次写入时会重新打开
+func (this *File) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	unregister(this)
+	if this.cleanStop != nil {
+		close(this.cleanStop)
+		this.cleanStop = nil
+	}
+	err := this.close()
+	if e := this.closeLock(); err == nil {
+		err = e
+	}
+	return err
+}
+
 func (this *File) Write(p []byte) (int, error) {
 	this.mu.Lock()
 	defer this.mu.Unlock()
+	return this.write(LevelAll, p)
+}
+
+// WriteRecord 实现IRecordWriter,开启SyncOnError时错误等级的日志立即同步到磁盘
+func (this *File) WriteRecord(r *Record, p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	n, err := this.write(r.Level, p)
+	if err == nil && this.SyncOnError && r.Level >= LevelError {
+		err = this.sync()
+	}
+	return n, err
+}
 
+// write 写入数据,level为日志等级,磁盘空间不足时用于判断是否丢弃
+func (this *File) write(level Level, p []byte) (int, error) {
 	//生成文件名
 	originFilename := this.getOriginFilename()
 	filename := this.addIndex(originFilename, this.fileIndex)
@@ -101,14 +391,38 @@ func (this *File) Write(p []byte) (int, error) {
 	}
 
 	//判断文件夹是否存在,不存在则新建
-	os.MkdirAll(filepath.Dir(filename), 0755)
+	os.MkdirAll(filepath.Dir(filename), this.dirMode())
+
+	//磁盘空间不足时丢弃错误等级以下的日志
+	if this.diskFull(filepath.Dir(filename)) && level < LevelError {
+		return len(p), nil
+	}
 
-	if this.file == nil || filename != this.filename ||
+	//检查文件是否被外部移动,删除或截断
+	if err := this.checkRotated(); err != nil {
+		reportError(nil, this, err)
+	}
+
+	//多进程写入时加锁,保证分片只执行一次
+	unlock, err := this.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	rotated, err := this.syncShared(originFilename)
+	if err != nil {
+		return 0, err
+	}
+
+	if this.file == nil || filename != this.filename || rotated ||
 		this.MaxSize > 0 && this.filesize+int64(len(p)) > this.MaxSize {
 
 		//文件名称发生变化,例如时间变化,或单个文件大小超出,新建文件
 		//则关闭之前的文件,并重新生成文件
-		this.close()
+		if this.file != nil {
+			this.close()
+			this.startCompress(this.filename)
+		}
 
 		//重置文件序号
 		if this.file == nil || filename != this.filename {
@@ -118,19 +432,30 @@ func (this *File) Write(p []byte) (int, error) {
 		//生成带后缀的文件名称
 		for ; ; this.fileIndex++ {
 			filename = this.addIndex(originFilename, this.fileIndex)
+			if this.isSealed(filename) {
+				//正在压缩,说明已经写满
+				continue
+			}
 			//获取文件信息
 			info, err := os.Stat(filename)
 			if err != nil && !os.IsNotExist(err) {
 				return 0, err
 			} else if os.IsNotExist(err) {
+				if isCompressed(filename) {
+					//已经压缩,说明已经写满
+					continue
+				}
 				break
 			}
 
 			//判断下一个序号是否存在,不存在则说明当前这个是最后(最新)一个文件,打开判断大小
-			_, err = os.Stat(this.addIndex(originFilename, this.fileIndex+1))
+			next := this.addIndex(originFilename, this.fileIndex+1)
+			_, err = os.Stat(next)
 			if err != nil && !os.IsNotExist(err) {
 				return 0, err
-			} else if err != nil && (info.Size() < this.MaxSize || this.MaxSize <= 0) {
+			} else if err != nil && !isCompressed(next) &&
+				(this.MaxSize <= 0 || info.Size() == 0 || info.Size()+int64(len(p)) <= this.MaxSize) {
+				//写入后不超过最大大小(空文件除外)才继续使用
 				break
 			}
 		}
@@ -141,7 +466,15 @@ func (this *File) Write(p []byte) (int, error) {
 	}
 
 	//写入数据
-	n, err := this.file.Write(p)
+	var w io.Writer = this.file
+	if this.buf != nil {
+		w = this.buf
+	}
+	n, err := w.Write(p)
+	if err == nil && this.Lock {
+		//加锁时缓存需要立即写入,保证其他进程获取的文件大小准确
+		err = this.flush()
+	}
 	if err != nil {
 		return 0, fmt.Errorf("写入文件 %s 失败: %w", this.filename, err)
 	}
@@ -0,0 +1,187 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//==============================Clean==============================
+
+// fileInfo 生成的日志文件
+type fileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// filePattern 文件名称格式对应的正则,能匹配时间格式和分片序号(-1,-2),
+// 以及查找文件的根目录和层级,只会匹配当前File生成的文件
+type filePattern struct {
+	root  string         //查找的根目录,不包含时间格式
+	depth int            //根目录下的最大层级
+	reg   *regexp.Regexp //完整路径的正则
+}
+
+// newFilePattern 解析文件名称格式,例 "./output/logs/2006-01-02/信息_15.log",
+// values为占位符的值,参考protectLayout,占位符的值不会被当成时间格式,
+// 目录名称包含数字(例如临时目录)时通过占位符传入,根目录才能定位到该目录
+func newFilePattern(filename string, values []string) *filePattern {
+	filename = filepath.Clean(filename)
+	ext := filepath.Ext(filename)
+	if hasLayout(ext) {
+		ext = ""
+	}
+	reg := layoutRegexp(filepath.ToSlash(filename[:len(filename)-len(ext)])) +
+		`(-\d+)?` + regexp.QuoteMeta(ext) + `(` + regexp.QuoteMeta(compressedExt) + `)?`
+	reg = restoreLayout(reg, values, regexp.QuoteMeta)
+
+	//查找不包含时间格式的目录作为根目录
+	segments := strings.Split(filepath.ToSlash(filepath.Dir(filename)), "/")
+	root, i := "", 0
+	for ; i < len(segments); i++ {
+		if hasLayout(segments[i]) {
+			break
+		}
+		root += segments[i] + "/"
+	}
+	if len(root) == 0 {
+		root = "."
+	}
+	return &filePattern{
+		root:  filepath.Clean(filepath.FromSlash(restoreLayout(root, values, nil))),
+		depth: len(segments) - i + 1,
+		reg:   regexp.MustCompile(`^` + reg + `$`),
+	}
+}
+
+// list 列出匹配的文件,按修改时间从新到旧排序
+func (this *filePattern) list() ([]*fileInfo, error) {
+	var files []*fileInfo
+	rootDepth := strings.Count(filepath.ToSlash(this.root), "/")
+	err := filepath.Walk(this.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || path != this.root {
+				//根目录下其他程序的目录可能没有权限,跳过
+				return nil
+			}
+			return err
+		}
+		depth := strings.Count(filepath.ToSlash(path), "/") - rootDepth
+		if this.root == "." {
+			depth++
+		}
+		if info.IsDir() {
+			if path != this.root && depth >= this.depth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if this.reg.MatchString(filepath.ToSlash(path)) {
+			files = append(files, &fileInfo{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	return files, err
+}
+
+// CleanInterval 定时清理过期文件的间隔,文件长时间没有写入(不分片)时也能按照MaxAge清理
+var CleanInterval = time.Minute
+
+// needClean 是否设置了保留策略
+func (this *File) needClean() bool {
+	return this.MaxAge > 0 || this.MaxBackups > 0 || this.MaxTotalSize > 0
+}
+
+// startClean 后台清理过期的文件,同时只有一个清理在执行
+func (this *File) startClean() {
+	if !this.needClean() || !atomic.CompareAndSwapInt32(&this.cleaning, 0, 1) {
+		return
+	}
+	current := this.filename
+	go func() {
+		defer atomic.StoreInt32(&this.cleaning, 0)
+		this.clean(current)
+	}()
+}
+
+// runClean 定时清理过期的文件,直到stop关闭
+func (this *File) runClean(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			this.mu.Lock()
+			this.startClean()
+			this.mu.Unlock()
+		}
+	}
+}
+
+// clean 依次按照MaxAge,MaxBackups,MaxTotalSize从旧到新删除生成的文件,不会删除当前正在写入的文件
+func (this *File) clean(current string) error {
+	files, err := this.pattern().list()
+	if err != nil {
+		return err
+	}
+	remove := func(v *fileInfo) {
+		if err := os.Remove(v.path); err != nil && !os.IsNotExist(err) {
+			reportError(nil, this, err)
+		}
+	}
+
+	//按照修改时间删除过期的文件
+	now := this.now()
+	total := int64(0)
+	backups := []*fileInfo(nil)
+	for _, v := range files {
+		if filepath.Clean(v.path) == filepath.Clean(current) {
+			total += v.size
+			continue
+		}
+		if this.MaxAge > 0 && now.Sub(v.modTime) > this.MaxAge {
+			remove(v)
+			continue
+		}
+		backups = append(backups, v)
+	}
+
+	//保留最新的MaxBackups个历史文件
+	if this.MaxBackups > 0 && len(backups) > this.MaxBackups {
+		for _, v := range backups[this.MaxBackups:] {
+			remove(v)
+		}
+		backups = backups[:this.MaxBackups]
+	}
+
+	//总大小超出时从最旧的开始删除,当前文件计入总大小
+	for _, v := range backups {
+		total += v.size
+	}
+	for i := len(backups) - 1; i >= 0 && this.MaxTotalSize > 0 && total > this.MaxTotalSize; i-- {
+		remove(backups[i])
+		total -= backups[i].size
+	}
+	return nil
+}
+
+// pattern 缓存文件名称格式的解析结果
+func (this *File) pattern() *filePattern {
+	this.patternMu.Lock()
+	defer this.patternMu.Unlock()
+	if this.filePattern == nil || this.patternName != this.Filename {
+		this.filePattern = newFilePattern(this.layout())
+		this.patternName = this.Filename
+	}
+	return this.filePattern
+}
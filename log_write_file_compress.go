@@ -0,0 +1,101 @@
+package logs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strconv"
+)
+
+//==============================Compress==============================
+
+// compressLimit 同时压缩的文件数量
+var compressLimit = make(chan struct{}, 2)
+
+// compressedExt 压缩文件的后缀
+const compressedExt = ".gz"
+
+// isCompressed 文件是否已经被压缩
+func isCompressed(filename string) bool {
+	_, err := os.Stat(filename + compressedExt)
+	return err == nil
+}
+
+// startCompress 后台压缩写完的文件,压缩完成前标记为封存,分片时不会再打开,需要加锁
+func (this *File) startCompress(filename string) {
+	if !this.Compress || len(filename) == 0 {
+		return
+	}
+	if this.sealed == nil {
+		this.sealed = make(map[string]struct{})
+	}
+	this.sealed[filename] = struct{}{}
+	go func() {
+		compressLimit <- struct{}{}
+		defer func() { <-compressLimit }()
+		if err := compressFile(filename); err != nil {
+			reportError(nil, this, err)
+		}
+		this.mu.Lock()
+		delete(this.sealed, filename)
+		this.mu.Unlock()
+	}()
+}
+
+// isSealed 文件是否已经交给压缩,需要加锁
+func (this *File) isSealed(filename string) bool {
+	_, ok := this.sealed[filename]
+	return ok
+}
+
+// compressFile 压缩文件,先写入临时文件再重命名,避免中途崩溃留下不完整的压缩文件,
+// 压缩成功后删除原文件
+func compressFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			//已经被删除或压缩
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	//多进程(File.Lock)可能同时压缩同一个文件,临时文件加上进程号
+	tmp := filename + compressedExt + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(dst)
+	gz.Name = info.Name()
+	gz.ModTime = info.ModTime()
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filename+compressedExt); err != nil {
+		return err
+	}
+	os.Chtimes(filename+compressedExt, info.ModTime(), info.ModTime())
+	src.Close()
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//==============================Disk==============================
+
+// DiskFullPolicy 磁盘剩余空间低于MinFreeSpace时的处理方式
+type DiskFullPolicy int
+
+const (
+	DiskFullDrop  DiskFullPolicy = iota //停止写入错误等级(LevelError)以下的日志,直接Write的数据也会停止
+	DiskFullClean                       //从旧到新删除生成的文件,直到空间足够,删除完仍不足则同DiskFullDrop
+)
+
+var (
+	// DiskCheckInterval 检查磁盘剩余空间的间隔
+	DiskCheckInterval = time.Second * 5
+
+	// errDiskUnsupported 当前系统不支持获取磁盘剩余空间
+	errDiskUnsupported = errors.New("logs: disk free space not supported")
+
+	// diskFree 获取目录所在磁盘的剩余可用空间,方便测试替换
+	diskFree = statDisk
+)
+
+// diskFull 按照DiskCheckInterval检查磁盘剩余空间,返回空间是否不足,
+// 状态变化(不足或恢复)时输出一条提示
+func (this *File) diskFull(dir string) bool {
+	if this.MinFreeSpace <= 0 {
+		return false
+	}
+	now := this.now()
+	if !this.diskCheck.IsZero() && now.Sub(this.diskCheck) < DiskCheckInterval {
+		return this.diskLow
+	}
+	this.diskCheck = now
+	free, err := diskFree(dir)
+	if err != nil {
+		//获取失败保持之前的状态,不支持的系统不检查
+		if err != errDiskUnsupported {
+			reportError(nil, this, err)
+		}
+		return this.diskLow
+	}
+	if free < this.MinFreeSpace && this.DiskFull == DiskFullClean {
+		free = this.cleanDisk(dir, free)
+	}
+	if low := free < this.MinFreeSpace; low != this.diskLow {
+		this.diskLow = low
+		this.notifyDisk(low, free)
+	}
+	return this.diskLow
+}
+
+// cleanDisk 从旧到新删除生成的文件(不含当前文件),直到剩余空间足够,返回删除后的剩余空间
+func (this *File) cleanDisk(dir string, free int64) int64 {
+	files, err := this.pattern().list()
+	if err != nil {
+		reportError(nil, this, err)
+	}
+	for i := len(files) - 1; i >= 0 && free < this.MinFreeSpace; i-- {
+		if filepath.Clean(files[i].path) == filepath.Clean(this.filename) {
+			continue
+		}
+		if err := os.Remove(files[i].path); err != nil {
+			if !os.IsNotExist(err) {
+				reportError(nil, this, err)
+			}
+			continue
+		}
+		if free, err = diskFree(dir); err != nil {
+			break
+		}
+	}
+	return free
+}
+
+// notifyDisk 输出磁盘空间状态变化的提示,优先输出到DiskNotify,否则写入ErrorWriter
+func (this *File) notifyDisk(low bool, free int64) {
+	msg := fmt.Sprintf("[logs] disk free space recovered (%d bytes), resume writing to %s\n", free, this.Filename)
+	if low {
+		msg = fmt.Sprintf("[logs] disk free space %d bytes below %d, stop writing logs below error level to %s\n",
+			free, this.MinFreeSpace, this.Filename)
+	}
+	e := this.DiskNotify
+	if e == nil {
+		if ErrorWriter != nil {
+			fmt.Fprint(ErrorWriter, msg)
+		}
+		return
+	}
+	//实体可能也写入当前文件,在协程中输出,避免重复加锁
+	go func() {
+		r := e.newRecord(0, msg)
+		r.File, r.Line = "", 0
+		e.WriteRecord(r, []byte(formatRecord(e.getFormatter(), r)))
+	}()
+}
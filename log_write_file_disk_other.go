@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package logs
+
+// statDisk 暂时只支持linux,darwin,freebsd和windows,其他系统不检查
+func statDisk(dir string) (int64, error) {
+	return 0, errDiskUnsupported
+}
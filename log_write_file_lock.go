@@ -0,0 +1,66 @@
+package logs
+
+import (
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+//==============================Lock==============================
+
+// lockFilename 锁文件的名称,相同文件名称格式的进程使用同一个锁文件,放在文件的根目录下
+func (this *File) lockFilename() string {
+	h := fnv.New32a()
+	h.Write([]byte(filepath.ToSlash(filepath.Clean(this.Filename))))
+	return filepath.Join(this.pattern().root, ".logs-"+strconv.FormatUint(uint64(h.Sum32()), 16)+".lock")
+}
+
+// lock 开启Lock时,跨进程加锁,返回解锁函数
+func (this *File) lock() (func(), error) {
+	if !this.Lock {
+		return func() {}, nil
+	}
+	if this.lockFile == nil {
+		filename := this.lockFilename()
+		os.MkdirAll(filepath.Dir(filename), this.dirMode())
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, this.fileMode())
+		if err != nil {
+			return nil, err
+		}
+		this.lockFile = f
+	}
+	if err := flock(this.lockFile); err != nil {
+		return nil, err
+	}
+	f := this.lockFile
+	return func() { funlock(f) }, nil
+}
+
+// closeLock 关闭锁文件
+func (this *File) closeLock() error {
+	if this.lockFile != nil {
+		err := this.lockFile.Close()
+		this.lockFile = nil
+		return err
+	}
+	return nil
+}
+
+// syncShared 开启Lock时,其他进程可能写入或分片了文件,
+// 重新获取文件大小,并判断下一个序号的文件是否已经存在,存在则需要切换
+func (this *File) syncShared(originFilename string) (rotated bool, err error) {
+	if !this.Lock || this.file == nil {
+		return false, nil
+	}
+	info, err := this.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	this.filesize = this.bufferedSize(info.Size())
+	next := this.addIndex(originFilename, this.fileIndex+1)
+	if _, err := os.Stat(next); err == nil || isCompressed(next) {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package logs
+
+import (
+	"os"
+	"syscall"
+)
+
+// flock 文件加锁(阻塞),多个进程之间互斥
+func flock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// funlock 文件解锁
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
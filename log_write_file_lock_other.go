@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package logs
+
+import (
+	"os"
+)
+
+// flock 暂时只支持linux,其他系统不加锁
+func flock(f *os.File) error {
+	return nil
+}
+
+// funlock 暂时只支持linux,其他系统不加锁
+func funlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package logs
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+//==============================Reopen==============================
+
+// ReopenOnSignal 收到信号时重新打开所有文件,默认SIGHUP,配合logrotate使用,
+// 返回的函数用于停止监听
+func ReopenOnSignal(sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sig...)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-c:
+				ReopenFiles()
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// ReopenFiles 重新打开所有已经打开的文件
+func ReopenFiles() {
+	closers.Range(func(key, value interface{}) bool {
+		if f, ok := key.(*File); ok {
+			if err := f.Reopen(); err != nil {
+				reportError(nil, f, err)
+			}
+		}
+		return true
+	})
+}
+
+// Reopen 重新打开当前文件,文件被外部移动或删除后会新建文件,并重新统计文件大小
+func (this *File) Reopen() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.reopen()
+}
+
+func (this *File) reopen() error {
+	if this.file == nil {
+		return nil
+	}
+	filename := this.filename
+	if err := this.close(); err != nil {
+		reportError(nil, this, err)
+	}
+	return this.open(filename)
+}
+
+// checkRotated 按照CheckInterval检查文件是否被外部移动,删除或截断(例如logrotate),
+// 移动或删除则重新打开,截断则重新统计文件大小
+func (this *File) checkRotated() error {
+	if this.CheckInterval <= 0 || this.file == nil {
+		return nil
+	}
+	now := this.now()
+	if now.Sub(this.lastCheck) < this.CheckInterval {
+		return nil
+	}
+	this.lastCheck = now
+
+	info, err := os.Stat(this.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	current, e := this.file.Stat()
+	if e != nil {
+		return e
+	}
+	if os.IsNotExist(err) || !os.SameFile(info, current) {
+		return this.reopen()
+	}
+	if size := this.bufferedSize(info.Size()); size < this.filesize {
+		this.filesize = size
+	}
+	return nil
+}
+
+// bufferedSize 文件大小加上缓存中还未写入的大小
+func (this *File) bufferedSize(size int64) int64 {
+	if this.buf != nil {
+		size += int64(this.buf.Buffered())
+	}
+	return size
+}
@@ -0,0 +1,482 @@
+package logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayoutRegexp(t *testing.T) {
+	now := time.Date(2024, 2, 1, 8, 2, 5, 0, time.Local)
+	for _, layout := range []string{
+		"2006-01-02/信息_15.log",
+		"Jan_2 3PM.log",
+		"app_20060102150405.000.log",
+		"Monday-MST-0700.log",
+		"app1.log",
+	} {
+		reg := regexp.MustCompile(`^` + layoutRegexp(layout) + `$`)
+		if name := now.Format(layout); !reg.MatchString(name) {
+			t.Errorf("%s: %s not match %s", layout, reg, name)
+		}
+	}
+	for layout, unit := range map[string]layoutUnit{
+		"app.log":               unitNone,
+		"2006/app.log":          unitYear,
+		"2006-01/app.log":       unitMonth,
+		"2006-01-02/app.log":    unitDay,
+		"2006-01-02/app_15.log": unitHour,
+		"app_1504.log":          unitMinute,
+		"app_150405.log":        unitSecond,
+	} {
+		if got := layoutUnitOf(layout); got != unit {
+			t.Errorf("%s: expected unit %d, got %d", layout, unit, got)
+		}
+	}
+}
+
+func TestFileClean(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	create := func(name string, age time.Duration) string {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		ioutil.WriteFile(filename, []byte("test"), 0644)
+		os.Chtimes(filename, now.Add(-age), now.Add(-age))
+		return filename
+	}
+	current := create("2024-02-04/信息_08.log", 0)
+	backup := create("2024-02-03/信息_08-1.log", time.Hour)
+	create("2024-02-03/信息_08.log", time.Hour*2)
+	create("2024-02-02/信息_08.log", time.Hour*3)
+	old := create("2024-02-01/信息_08.log", time.Hour*48)
+	other := create("2024-02-01/错误_08.log", time.Hour*48)
+	notes := create("2024-02-01/notes.txt", time.Hour*48)
+
+	//临时目录的名称包含数字,通过占位符传入,避免被当成时间格式
+	f := &File{Filename: "{dir}/2006-01-02/信息_15.log", Values: map[string]string{"dir": dir}, MaxAge: time.Hour * 24}
+	if err := f.clean(current); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := f.pattern().list()
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(files))
+	}
+	for _, v := range []string{old} {
+		if _, err := os.Stat(v); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed", v)
+		}
+	}
+	for _, v := range []string{other, notes} {
+		if _, err := os.Stat(v); err != nil {
+			t.Fatalf("%s should be kept", v)
+		}
+	}
+
+	f.MaxAge, f.MaxBackups = 0, 1
+	f.clean(current)
+	if files, _ = f.pattern().list(); len(files) != 2 || files[0].path != current {
+		t.Fatalf("expected current and 1 backup, got %d", len(files))
+	}
+
+	//总大小超出时从最旧的开始删除
+	create("2024-02-03/信息_08.log", time.Hour*2)
+	create("2024-02-02/信息_08.log", time.Hour*3)
+	f.MaxBackups, f.MaxTotalSize = 0, 10
+	f.clean(current)
+	if files, _ = f.pattern().list(); len(files) != 2 || files[1].path != backup {
+		t.Fatalf("expected current and newest backup, got %d", len(files))
+	}
+}
+
+func TestFileCleanInterval(t *testing.T) {
+	old := CleanInterval
+	CleanInterval = time.Millisecond * 10
+	defer func() { CleanInterval = old }()
+
+	dir := t.TempDir()
+	f := &File{Filename: "{dir}/app.log", Values: map[string]string{"dir": dir}, MaxAge: time.Hour}
+	defer f.Close()
+	f.Write([]byte("test\n"))
+
+	//打开之后才过期的文件,由定时清理删除
+	expired := filepath.Join(dir, "app-1.log")
+	ioutil.WriteFile(expired, []byte("test"), 0644)
+	os.Chtimes(expired, time.Now().Add(-time.Hour*2), time.Now().Add(-time.Hour*2))
+	for i := 0; ; i++ {
+		if _, err := os.Stat(expired); os.IsNotExist(err) {
+			break
+		}
+		if i > 100 {
+			t.Fatal("expired file not removed")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestFileCompress(t *testing.T) {
+	dir := t.TempDir()
+	f := &File{Filename: "{dir}/app.log", Values: map[string]string{"dir": dir}, MaxSize: 10, Compress: true}
+	defer f.Close()
+	for i := 0; i < 3; i++ {
+		f.Write([]byte("0123456789"))
+		<-time.After(time.Millisecond * 50)
+	}
+	for _, v := range []string{"app.log.gz", "app-1.log.gz", "app-2.log"} {
+		if _, err := os.Stat(filepath.Join(dir, v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, err := os.Open(filepath.Join(dir, "app-1.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	r, err := gzip.NewReader(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := ioutil.ReadAll(r); string(bs) != "0123456789" {
+		t.Fatalf("unexpected content: %q", bs)
+	}
+}
+
+func TestFileCompressLines(t *testing.T) {
+	dir := t.TempDir()
+	f := &File{Filename: "{dir}/app.log", Values: map[string]string{"dir": dir}, MaxSize: 100, Compress: true}
+	for i := 0; i < 40; i++ {
+		f.Write([]byte(fmt.Sprintf("line %02d\n", i)))
+		time.Sleep(time.Millisecond)
+	}
+	f.Close()
+
+	//等待后台压缩完成
+	for i := 0; ; i++ {
+		f.mu.Lock()
+		n := len(f.sealed)
+		f.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i > 300 {
+			t.Fatal("compress timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	lines := map[string]bool{}
+	files, _ := f.pattern().list()
+	for _, v := range files {
+		bs, err := ioutil.ReadFile(v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Ext(v.path) == compressedExt {
+			r, err := gzip.NewReader(bytes.NewReader(bs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bs, err = ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(bs)), "\n") {
+			lines[line] = true
+		}
+	}
+	if len(lines) != 40 {
+		t.Fatalf("expected 40 lines, got %d", len(lines))
+	}
+}
+
+func TestFileBuffer(t *testing.T) {
+	dir := t.TempDir()
+	f := &File{Filename: "{dir}/app.log", Values: map[string]string{"dir": dir}, BufferSize: 1024, FlushInterval: time.Hour, SyncOnError: true}
+	defer f.Close()
+	size := func() int64 {
+		info, err := os.Stat(filepath.Join(dir, "app.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	f.Write([]byte("info\n"))
+	if n := size(); n != 0 {
+		t.Fatalf("expected buffered, got size %d", n)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if n := size(); n != 5 {
+		t.Fatalf("expected size 5, got %d", n)
+	}
+	f.WriteRecord(&Record{Level: LevelError}, []byte("error\n"))
+	if n := size(); n != 11 {
+		t.Fatalf("expected size 11, got %d", n)
+	}
+	f.Write([]byte("info\n"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := size(); n != 16 {
+		t.Fatalf("expected size 16, got %d", n)
+	}
+}
+
+func TestFileRotate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 31, 23, 59, 59, 0, time.Local)
+	clock := func() time.Time { return now }
+	for _, v := range []struct {
+		layout string
+		every  time.Duration
+		step   time.Duration
+		names  []string
+	}{
+		{"sec_150405.log", 0, time.Millisecond * 500, []string{"sec_235959.log", "sec_235959.log", "sec_000000.log"}},
+		{"month_2006-01.log", 0, time.Second, []string{"month_2024-01.log", "month_2024-02.log", "month_2024-02.log"}},
+		{"every_02_1504.log", time.Hour * 6, time.Hour * 3, []string{"every_31_1800.log", "every_01_0000.log", "every_01_0000.log"}},
+	} {
+		now = time.Date(2024, 1, 31, 23, 59, 59, 0, time.Local)
+		f := &File{Filename: "{dir}/" + v.layout, Values: map[string]string{"dir": dir}, RotateEvery: v.every, Now: clock}
+		for i, name := range v.names {
+			if i > 0 {
+				now = now.Add(v.step)
+			}
+			f.Write([]byte("test\n"))
+			if f.filename != filepath.Join(dir, name) {
+				t.Errorf("%s: expected %s, got %s", v.layout, name, f.filename)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	a := NewEntity("a").SetShowColor(false).SetWriter().WriteToFile("./app.log")
+	b := NewEntity("b").SetShowColor(false).SetWriter().WriteToFile("app.log").WriteToFile("app.log")
+	c := NewEntity("c").SetShowColor(false).SetWriter().WriteToFile("{type}.log")
+	if len(b.Writer) != 1 || a.Writer[0] != b.Writer[0] || a.Writer[0] == c.Writer[0] {
+		t.Fatal("expected shared file")
+	}
+	a.Writer[0].(*File).Close()
+	c.Writer[0].(*File).Close()
+}
+
+func TestFilePlaceholder(t *testing.T) {
+	e := NewEntity("app1").SetTag("tcp", "2").SetShowColor(false).SetWriter()
+	e.WriteToFile("output/{type}_{tag}_{pid}_{unknown}_2006.log")
+	e.Println("test")
+	f := e.Writer[0].(*File)
+	defer os.Remove(f.filename)
+	defer f.Close()
+	name := fmt.Sprintf("app1_tcp_2_%d_{unknown}_%d.log", os.Getpid(), time.Now().Year())
+	if f.filename != filepath.Join("output", name) {
+		t.Fatalf("unexpected filename: %s", f.filename)
+	}
+	if files, _ := f.pattern().list(); len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	f := &File{Filename: "{dir}/app.log", Values: map[string]string{"dir": dir}, CheckInterval: time.Nanosecond}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("second\n"))
+	if bs, _ := ioutil.ReadFile(name); string(bs) != "second\n" {
+		t.Fatalf("unexpected content: %q", bs)
+	}
+
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("third\n"))
+	if f.filesize != 6 {
+		t.Fatalf("expected filesize 6, got %d", f.filesize)
+	}
+
+	os.Remove(name)
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); err != nil || f.filesize != 0 {
+		t.Fatalf("expected new file, got %v %d", err, f.filesize)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	values := map[string]string{"dir": t.TempDir()}
+
+	//两个File模拟两个进程写入相同的文件
+	a := &File{Filename: "{dir}/app.log", Values: values, MaxSize: 100, Lock: true}
+	b := &File{Filename: "{dir}/app.log", Values: values, MaxSize: 100, Lock: true}
+	defer a.Close()
+	defer b.Close()
+	done := make(chan struct{})
+	for _, f := range []*File{a, b} {
+		go func(f *File) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 50; i++ {
+				f.Write([]byte("012345678\n"))
+			}
+		}(f)
+	}
+	<-done
+	<-done
+
+	files, _ := a.pattern().list()
+	total := int64(0)
+	for _, v := range files {
+		if v.size > 100 {
+			t.Errorf("%s size %d over MaxSize", v.path, v.size)
+		}
+		total += v.size
+	}
+	if total != 1000 || len(files) != 10 {
+		t.Fatalf("expected 10 files and 1000 bytes, got %d files %d bytes", len(files), total)
+	}
+}
+
+func TestFileMaxSize(t *testing.T) {
+	//记录大小不能整除MaxSize,分片后也不能超出
+	line := []byte("0123456789012345678901234567\n")
+	for _, lock := range []bool{false, true} {
+		values := map[string]string{"dir": t.TempDir()}
+		a := &File{Filename: "{dir}/app.log", Values: values, MaxSize: 100, Lock: lock}
+		b := &File{Filename: "{dir}/app.log", Values: values, MaxSize: 100, Lock: lock}
+		for i := 0; i < 10; i++ {
+			a.Write(line)
+			if lock {
+				b.Write(line)
+			}
+		}
+		a.Close()
+		b.Close()
+		files, _ := a.pattern().list()
+		total := int64(0)
+		for _, v := range files {
+			if v.size > 100 {
+				t.Errorf("lock=%v: %s size %d over MaxSize", lock, v.path, v.size)
+			}
+			total += v.size
+		}
+		if want := int64(len(line)) * 10; !lock && total != want || lock && total != want*2 {
+			t.Fatalf("lock=%v: unexpected total %d", lock, total)
+		}
+	}
+}
+
+func TestFileDiskFull(t *testing.T) {
+	dir := t.TempDir()
+	values := map[string]string{"dir": dir}
+	oldFree, oldInterval, oldWriter := diskFree, DiskCheckInterval, ErrorWriter
+	defer func() { diskFree, DiskCheckInterval, ErrorWriter = oldFree, oldInterval, oldWriter }()
+	DiskCheckInterval = 0
+	warn := &syncBuffer{}
+	ErrorWriter = warn
+
+	//停止写入错误等级以下的日志
+	free := int64(0)
+	diskFree = func(dir string) (int64, error) { return free, nil }
+	f := &File{Filename: "{dir}/app.log", Values: values, MinFreeSpace: 100}
+	defer f.Close()
+	f.WriteRecord(&Record{Level: LevelInfo}, []byte("info\n"))
+	f.WriteRecord(&Record{Level: LevelInfo}, []byte("info\n"))
+	f.WriteRecord(&Record{Level: LevelError}, []byte("error\n"))
+	free = 1000
+	f.WriteRecord(&Record{Level: LevelInfo}, []byte("info\n"))
+	f.Close()
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if string(bs) != "error\ninfo\n" {
+		t.Fatalf("unexpected content %q", bs)
+	}
+	if warn.Count("stop writing") != 1 || warn.Count("resume writing") != 1 {
+		t.Fatalf("unexpected warning %q", warn.String())
+	}
+
+	//删除最旧的文件
+	g := &File{Filename: "{dir}/clean.log", Values: values, MaxSize: 10, DiskFull: DiskFullClean}
+	defer g.Close()
+	for i := 0; i < 5; i++ {
+		g.Write([]byte("012345678\n"))
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.MinFreeSpace = 100
+	diskFree = func(dir string) (int64, error) {
+		files, _ := g.pattern().list()
+		return int64(300 - len(files)*100), nil
+	}
+	g.Write([]byte("012345678\n"))
+	files, _ := g.pattern().list()
+	if len(files) != 3 || filepath.Base(files[2].path) != "clean-3.log" {
+		t.Fatalf("unexpected files %v", len(files))
+	}
+}
+
+func TestFileDiskCheckClock(t *testing.T) {
+	oldFree, oldWriter := diskFree, ErrorWriter
+	defer func() { diskFree, ErrorWriter = oldFree, oldWriter }()
+	ErrorWriter = nil
+	checks := 0
+	diskFree = func(dir string) (int64, error) {
+		checks++
+		return 0, nil
+	}
+
+	//按照File.Now判断检查间隔
+	now := time.Now()
+	f := &File{MinFreeSpace: 100, Now: func() time.Time { return now }}
+	f.diskFull(".")
+	f.diskFull(".")
+	now = now.Add(DiskCheckInterval)
+	f.diskFull(".")
+	if checks != 2 {
+		t.Fatalf("expected 2 checks, got %d", checks)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dir")
+	f := &File{
+		Filename: "{dir}/app.log",
+		Values:   map[string]string{"dir": dir},
+		MaxSize:  30,
+		FileMode: 0600,
+		DirMode:  0700,
+		Header:   func(filename string) string { return "# " + filepath.Base(filename) },
+	}
+	defer f.Close()
+	for i := 0; i < 3; i++ {
+		f.Write([]byte("012345678\n"))
+	}
+	f.Close()
+	for _, v := range []string{"app.log", "app-1.log"} {
+		bs, _ := ioutil.ReadFile(filepath.Join(dir, v))
+		if want := "# " + v + "\n"; len(bs) < len(want) || string(bs[:len(want)]) != want {
+			t.Fatalf("%s missing header: %q", v, bs)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(filepath.Join(dir, "app.log"))
+		dirInfo, _ := os.Stat(dir)
+		if info.Mode().Perm() != 0600 || dirInfo.Mode().Perm() != 0700 {
+			t.Fatalf("unexpected mode %v %v", info.Mode(), dirInfo.Mode())
+		}
+	}
+}
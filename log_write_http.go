@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
@@ -12,6 +13,20 @@ import (
 //==============================WriteHTTP==============================
 
 func NewHTTPClient(method, url string) io.Writer {
+	return NewHTTPClientWith(method, url, HTTPClientOption{})
+}
+
+// HTTPClientOption HTTP客户端的配置
+type HTTPClientOption struct {
+	QueueSize int    //内存队列大小,默认100
+	Spool     *Spool //磁盘队列,服务端不可用(网络错误或5xx)时暂存,恢复后按顺序发送,为nil不开启
+}
+
+// NewHTTPClientWith 推送至HTTP服务端,自定义配置
+func NewHTTPClientWith(method, url string, op HTTPClientOption) io.Writer {
+	if op.QueueSize <= 0 {
+		op.QueueSize = 100
+	}
 	w := &httpClient{
 		Client: &http.Client{
 			Transport: &http.Transport{
@@ -24,14 +39,29 @@ func NewHTTPClient(method, url string) io.Writer {
 		},
 		method: method,
 		url:    url,
-		Chan:   newChan(context.Background(), 100),
+		Chan:   newChan(context.Background(), op.QueueSize),
 	}
-	w.Chan.handler = func(ctx context.Context, count int, bs []byte) {
-		req, err := http.NewRequest(w.method, w.url, bytes.NewBuffer(bs))
-		if err == nil {
-			w.Client.Do(req)
+	w.Chan.handler = func(ctx context.Context, count int, r *Record, bs []byte) {
+		if op.Spool != nil {
+			op.Spool.deliver(encodeFrame(r, bs))
+			return
+		}
+		if err := w.post(bs); err != nil {
+			reportError(nil, w, err)
 		}
 	}
+	if op.Spool != nil {
+		w.Chan.closer = op.Spool.Close
+		op.Spool.start(w, func(frame []byte) error {
+			f, err := readFrame(bytes.NewReader(frame))
+			if err != nil {
+				//数据异常,丢弃
+				reportError(nil, w, err)
+				return nil
+			}
+			return w.post(f.Data)
+		})
+	}
 	return w
 }
 
@@ -41,3 +71,24 @@ type httpClient struct {
 	url    string
 	*Chan
 }
+
+// post 发送数据,网络错误和5xx返回错误(可以重新发送),4xx直接输出错误
+func (this *httpClient) post(bs []byte) error {
+	req, err := http.NewRequest(this.method, this.url, bytes.NewBuffer(bs))
+	if err != nil {
+		reportError(nil, this, err)
+		return nil
+	}
+	resp, err := this.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("http status %s", resp.Status)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		reportError(nil, this, fmt.Errorf("http status %s", resp.Status))
+	}
+	return nil
+}
@@ -3,8 +3,12 @@ package logs
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net"
 	"sync"
 	"time"
@@ -12,30 +16,105 @@ import (
 
 //==============================TCP==============================
 
-// NewTCPClient 推送至指定TCP服务器,断线重连
+// NewTCPClient 推送至指定TCP服务器,断线重连,每条日志编码成一帧,参考Frame
 func NewTCPClient(addr string) (io.Writer, error) {
-	c, err := net.Dial("tcp", addr)
-	if err != nil {
-		return nil, err
+	return NewTCPClientWith(addr, TCPClientOption{})
+}
+
+// NewTCPClientTLS 通过TLS推送至指定TCP服务器,双向认证时在config中设置客户端证书
+func NewTCPClientTLS(addr string, config *tls.Config) (io.Writer, error) {
+	return NewTCPClientWith(addr, TCPClientOption{TLSConfig: config})
+}
+
+// TCPClientOption TCP客户端的配置
+type TCPClientOption struct {
+	QueueSize    int                          //内存队列大小,默认100
+	Spool        *Spool                       //磁盘队列,服务器不可用时暂存,恢复后按顺序发送,为nil时未连接期间的日志被丢弃
+	Lazy         bool                         //创建时不等待连接,在后台连接,连接失败也不返回错误
+	DialTimeout  time.Duration                //连接超时时间,默认5秒
+	MinBackoff   time.Duration                //重连的最小间隔,默认1秒,每次失败翻倍并加上随机抖动
+	MaxBackoff   time.Duration                //重连的最大间隔,默认32秒
+	OnConnect    func(addr string)            //连接成功时执行
+	OnDisconnect func(addr string, err error) //连接断开时执行
+	TLSConfig    *tls.Config                  //TLS配置,为nil使用明文传输
+}
+
+func (this TCPClientOption) withDefault() TCPClientOption {
+	if this.QueueSize <= 0 {
+		this.QueueSize = 100
 	}
-	t := &tcpClient{
-		Conn: c,
-		Chan: newChan(context.Background(), 100),
+	if this.DialTimeout <= 0 {
+		this.DialTimeout = time.Second * 5
 	}
-	t.Chan.handler = func(ctx context.Context, count int, bs []byte) {
-		if t.Conn == nil {
-			var err error
-			t.Conn, err = net.Dial("tcp", addr)
-			if err != nil {
-				return
-			}
+	if this.MinBackoff <= 0 {
+		this.MinBackoff = time.Second
+	}
+	if this.MaxBackoff < this.MinBackoff {
+		this.MaxBackoff = time.Second * 32
+		if this.MaxBackoff < this.MinBackoff {
+			this.MaxBackoff = this.MinBackoff
 		}
-		_, err := t.Conn.Write(bs)
+	}
+	return this
+}
+
+// errNotConnected 未连接到服务器,等待后台重连
+var errNotConnected = errors.New("logs: not connected")
+
+// NewTCPClientWith 推送至指定TCP服务器,自定义配置,断开后在后台按照退避间隔重连,
+// 未设置Spool时,未连接期间的日志会被丢弃,计入队列统计(Stats)的Dropped,每次断开只通过OnError报告一次
+func NewTCPClientWith(addr string, op TCPClientOption) (io.Writer, error) {
+	op = op.withDefault()
+	t := &tcpClient{
+		addr:   addr,
+		op:     op,
+		redial: make(chan struct{}, 1),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		dial: func() (net.Conn, error) {
+			if op.TLSConfig != nil {
+				return tls.DialWithDialer(&net.Dialer{Timeout: op.DialTimeout}, "tcp", addr, op.TLSConfig)
+			}
+			return net.DialTimeout("tcp", addr, op.DialTimeout)
+		},
+	}
+	if !op.Lazy {
+		c, err := t.dial()
 		if err != nil {
-			t.Conn.Close()
-			t.Conn = nil
+			return nil, err
 		}
+		t.Conn = c
 	}
+	t.Chan = newChan(context.Background(), op.QueueSize)
+	t.Chan.handler = func(ctx context.Context, count int, r *Record, bs []byte) {
+		frame := encodeFrame(r, bs)
+		if op.Spool != nil {
+			op.Spool.deliver(frame)
+			return
+		}
+		if err := t.send(frame); err != nil {
+			t.fail(err)
+			return
+		}
+		t.failing = false
+	}
+	t.Chan.closer = func() error {
+		if op.Spool != nil {
+			op.Spool.Close()
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.Conn != nil {
+			return t.Conn.Close()
+		}
+		return nil
+	}
+	if t.Conn != nil {
+		t.connected(t.Conn)
+	}
+	if op.Spool != nil {
+		op.Spool.start(t, t.send)
+	}
+	go t.run(t.Chan.ctx)
 	return t, nil
 }
 
@@ -43,59 +122,228 @@ func NewTCPClient(addr string) (io.Writer, error) {
 type tcpClient struct {
 	net.Conn
 	*Chan
+	addr    string
+	op      TCPClientOption
+	dial    func() (net.Conn, error) //连接服务器
+	redial  chan struct{}            //连接断开,通知重连
+	rand    *rand.Rand               //重连间隔的随机抖动,只在run中使用
+	failing bool                     //发送失败,恢复前不再重复报告,只在队列的处理函数中使用
+	mu      sync.Mutex
+}
+
+// fail 发送失败,丢弃数据并计数,只在状态变化时输出一次错误
+func (this *tcpClient) fail(err error) {
+	this.Chan.drop()
+	if !this.failing {
+		reportError(nil, this, err)
+	}
+	this.failing = true
+}
+
+// run 后台重连,连接断开后按照退避间隔重新连接,间隔翻倍并加上随机抖动,避免同时重连
+func (this *tcpClient) run(ctx context.Context) {
+	backoff := this.op.MinBackoff
+	for {
+		if this.getConn() == nil {
+			c, err := this.dial()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff/2 + time.Duration(this.rand.Int63n(int64(backoff/2)+1))):
+				}
+				if backoff *= 2; backoff > this.op.MaxBackoff {
+					backoff = this.op.MaxBackoff
+				}
+				continue
+			}
+			this.mu.Lock()
+			if ctx.Err() != nil {
+				this.mu.Unlock()
+				c.Close()
+				return
+			}
+			this.Conn = c
+			this.mu.Unlock()
+			this.connected(c)
+			backoff = this.op.MinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-this.redial:
+		}
+	}
+}
+
+// connected 连接成功,执行OnConnect,并在后台读取,以便及时发现服务器断开连接
+func (this *tcpClient) connected(c net.Conn) {
+	if this.op.OnConnect != nil {
+		this.op.OnConnect(this.addr)
+	}
+	go func() {
+		_, err := io.Copy(ioutil.Discard, c)
+		if err == nil {
+			err = io.EOF
+		}
+		this.disconnect(c, err)
+	}()
+}
+
+// disconnect 关闭连接,执行OnDisconnect,并通知后台重连
+func (this *tcpClient) disconnect(c net.Conn, err error) {
+	this.mu.Lock()
+	if this.Conn != c {
+		this.mu.Unlock()
+		return
+	}
+	this.Conn = nil
+	this.mu.Unlock()
+	c.Close()
+	if this.op.OnDisconnect != nil {
+		this.op.OnDisconnect(this.addr, err)
+	}
+	select {
+	case this.redial <- struct{}{}:
+	default:
+	}
+}
+
+func (this *tcpClient) getConn() net.Conn {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.Conn
+}
+
+// send 发送一帧数据,未连接返回错误,失败则断开连接,等待后台重连
+func (this *tcpClient) send(frame []byte) error {
+	c := this.getConn()
+	if c == nil {
+		return errNotConnected
+	}
+	_, err := c.Write(frame)
+	if err != nil {
+		this.disconnect(c, err)
+	}
+	return err
 }
 
 func (this *tcpClient) Write(p []byte) (int, error) {
 	return this.Chan.Write(p)
 }
 
-// DialTCP 监听tcp数据
+// Close 关闭队列和连接
+func (this *tcpClient) Close() error {
+	return this.Chan.Close()
+}
+
+// DialTCP 监听tcp数据,每次回调一条日志(格式化后的数据),断线重连,logs.Close时停止
 func DialTCP(addr string, dealFunc func(p []byte)) error {
+	_, err := DialTCPFrame(addr, func(f *Frame) { dealFunc(f.Data) })
+	return err
+}
 
-	c, err := net.Dial("tcp", addr)
+// DialTCPFrame 监听tcp数据,每次回调一帧,包含等级,名称和时间,断线重连,Close停止
+func DialTCPFrame(addr string, dealFunc func(f *Frame)) (io.Closer, error) {
+	dialer := &net.Dialer{}
+	return dialFrame(func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}, dealFunc)
+}
+
+// DialTCPTLS 通过TLS监听tcp数据,每次回调一条日志,断线重连,Close停止
+func DialTCPTLS(addr string, config *tls.Config, dealFunc func(p []byte)) (io.Closer, error) {
+	dialer := &tls.Dialer{Config: config}
+	return dialFrame(func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}, func(f *Frame) { dealFunc(f.Data) })
+}
+
+// dialFrame 连接并读取帧数据,连接断开或数据异常时重新连接,间隔从1秒开始翻倍,最长32秒
+func dialFrame(dial func(ctx context.Context) (net.Conn, error), dealFunc func(f *Frame)) (io.Closer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := dial(ctx)
 	if err != nil {
-		return err
+		cancel()
+		return nil, err
 	}
+	d := &tcpDialer{ctx: ctx, cancel: cancel, dial: dial, deal: dealFunc, conn: c}
+	register(d)
+	go d.run(c)
+	return d, nil
+}
 
-	buf := bufio.NewReader(c)
+// tcpDialer 监听tcp数据的客户端,关闭时取消正在进行的连接和重连等待
+type tcpDialer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	dial   func(ctx context.Context) (net.Conn, error)
+	deal   func(f *Frame)
+	conn   net.Conn //当前连接,重连期间为nil
+	mu     sync.Mutex
+}
 
-	readAll := func(buf *bufio.Reader) (bytes []byte, err error) {
-		num := 1 << 10
+// run 读取帧数据,连接断开后按照退避间隔重连,直到关闭
+func (this *tcpDialer) run(c net.Conn) {
+	for {
+		buf := bufio.NewReader(c)
 		for {
-			data := make([]byte, num)
-			length, err := buf.Read(data)
+			f, err := readFrame(buf)
 			if err != nil {
-				return nil, err
-			}
-			bytes = append(bytes, data[:length]...)
-			if length < num || buf.Buffered() == 0 {
-				//缓存没有剩余的数据
-				return bytes, err
+				break
 			}
+			this.deal(f)
+		}
+		c.Close()
+		if c = this.redial(); c == nil {
+			return
 		}
 	}
-	go func() {
-		defer func() {
-			i := time.Second
-			for {
-				if DialTCP(addr, dealFunc) != nil {
-					return
-				}
-				if i < time.Second*32 {
-					i *= 2
-				}
-				<-time.After(i)
-			}
-		}()
-		for {
-			bytes, err := readAll(buf)
-			if err != nil {
-				return
+}
+
+// redial 按照退避间隔重连,已关闭返回nil
+func (this *tcpDialer) redial() net.Conn {
+	this.setConn(nil)
+	for i := time.Second; ; {
+		select {
+		case <-this.ctx.Done():
+			return nil
+		case <-time.After(i):
+		}
+		c, err := this.dial(this.ctx)
+		if err == nil {
+			if !this.setConn(c) {
+				c.Close()
+				return nil
 			}
-			dealFunc(bytes)
+			return c
 		}
-	}()
+		if i < time.Second*32 {
+			i *= 2
+		}
+	}
+}
+
+// setConn 设置当前连接,已关闭返回false
+func (this *tcpDialer) setConn(c net.Conn) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.ctx.Err() != nil {
+		return false
+	}
+	this.conn = c
+	return true
+}
 
+// Close 停止重连并关闭当前连接
+func (this *tcpDialer) Close() error {
+	unregister(this)
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.cancel()
+	if this.conn != nil {
+		return this.conn.Close()
+	}
 	return nil
 }
 
@@ -105,57 +353,189 @@ func DialTCP(addr string, dealFunc func(p []byte)) error {
 
  */
 
-// NewTCPServer 推送至TCP所有连接的客户端
+// NewTCPServer 推送至TCP所有连接的客户端,每条日志编码成一帧,参考Frame
 func NewTCPServer(port int) (io.Writer, error) {
+	return NewTCPServerWith(port, TCPServerOption{})
+}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// NewTCPServerTLS 通过TLS推送至所有连接的客户端,需要验证客户端证书时,
+// 在config中设置 ClientAuth: tls.RequireAndVerifyClientCert 和 ClientCAs
+func NewTCPServerTLS(port int, config *tls.Config) (io.Writer, error) {
+	return NewTCPServerWith(port, TCPServerOption{TLSConfig: config})
+}
+
+// TCPServerOption TCP服务端的配置
+type TCPServerOption struct {
+	Backlog    int           //新连接的客户端先收到最近的日志条数,默认0不发送
+	BacklogAge time.Duration //只发送最近这段时间内的日志,0为不限制
+	TLSConfig  *tls.Config   //TLS配置,为nil使用明文传输
+}
+
+// NewTCPServerWith 推送至TCP所有连接的客户端,自定义配置
+func NewTCPServerWith(port int, op TCPServerOption) (io.Writer, error) {
+
+	var listener net.Listener
+	var err error
+	if op.TLSConfig != nil {
+		listener, err = tls.Listen("tcp", fmt.Sprintf(":%d", port), op.TLSConfig)
+	} else {
+		listener, err = net.Listen("tcp", fmt.Sprintf(":%d", port))
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	return newTCPServer(listener, op), nil
+}
+
+// TLSHandshakeTimeout TLS服务端握手的超时时间
+var TLSHandshakeTimeout = time.Second * 10
+
+// BacklogWriteTimeout 给新连接发送最近日志的超时时间
+var BacklogWriteTimeout = time.Second * 10
+
+// TCPServerWriteTimeout 给客户端发送一帧的超时时间,超时断开该客户端
+var TCPServerWriteTimeout = time.Second * 10
+
+func newTCPServer(listener net.Listener, op TCPServerOption) *tcpServer {
+
 	writer := &tcpServer{
 		listener: listener,
-		conn:     make(map[string]net.Conn),
+		conn:     make(map[string]*tcpServerConn),
+		op:       op,
 		Chan:     newChan(context.Background(), 100),
 	}
 
-	writer.Chan.handler = func(ctx context.Context, count int, bs []byte) {
+	writer.Chan.handler = func(ctx context.Context, count int, r *Record, bs []byte) {
 		errKey := []string(nil)
-		for i, v := range writer.getConn() {
-			if _, err := v.Write(bs); err != nil {
+		frame := encodeFrame(r, bs)
+		for i, v := range writer.pushBacklog(frame) {
+			switch err := v.send(frame); err {
+			case nil:
+			case ErrQueueFull:
+				//客户端读取太慢,丢弃这一帧,不影响其他客户端
+				writer.Chan.drop()
+			default:
 				errKey = append(errKey, i)
 			}
 		}
 		writer.delConn(errKey...)
 	}
+	writer.Chan.closer = func() error {
+		err := writer.listener.Close()
+		for k := range writer.getConn() {
+			writer.delConn(k)
+		}
+		return err
+	}
 
 	go writer.run()
 
-	return writer, nil
+	return writer
 }
 
 type tcpServer struct {
 	listener net.Listener
-	conn     map[string]net.Conn
+	conn     map[string]*tcpServerConn
+	op       TCPServerOption
+	backlog  []tcpBacklog //最近的日志,环形缓冲
+	head     int          //最旧的日志的位置
+	size     int          //日志数量
 	mu       sync.RWMutex
 	*Chan
 }
 
+// tcpBacklog 最近的一条日志
+type tcpBacklog struct {
+	time  time.Time
+	frame []byte
+}
+
+// pushBacklog 日志加入最近的日志,并返回当前的连接,
+// 和addConn使用同一个锁,保证新连接的客户端不会重复或遗漏日志
+func (this *tcpServer) pushBacklog(frame []byte) map[string]*tcpServerConn {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.op.Backlog > 0 {
+		if this.backlog == nil {
+			this.backlog = make([]tcpBacklog, this.op.Backlog)
+		}
+		item := tcpBacklog{time: time.Now(), frame: frame}
+		if this.size < len(this.backlog) {
+			this.backlog[(this.head+this.size)%len(this.backlog)] = item
+			this.size++
+		} else {
+			this.backlog[this.head] = item
+			this.head = (this.head + 1) % len(this.backlog)
+		}
+	}
+	m := make(map[string]*tcpServerConn, len(this.conn))
+	for i, v := range this.conn {
+		m[i] = v
+	}
+	return m
+}
+
+// backlogBytes 最近的日志,去掉超过BacklogAge的,需要加锁
+func (this *tcpServer) backlogBytes() []byte {
+	var bs []byte
+	for i := 0; i < this.size; i++ {
+		item := this.backlog[(this.head+i)%len(this.backlog)]
+		if this.op.BacklogAge > 0 && time.Since(item.time) > this.op.BacklogAge {
+			continue
+		}
+		bs = append(bs, item.frame...)
+	}
+	return bs
+}
+
 func (this *tcpServer) run() {
 	for {
 		c, err := this.listener.Accept()
 		if err != nil {
 			return
 		}
-		this.mu.Lock()
-		this.conn[c.RemoteAddr().String()] = c
-		this.mu.Unlock()
+		if tc, ok := c.(*tls.Conn); ok {
+			//握手成功(包括验证客户端证书)后才推送数据,握手在协程中执行,避免阻塞其他连接
+			go func() {
+				tc.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+				if err := tc.Handshake(); err != nil {
+					tc.Close()
+					reportError(nil, this, fmt.Errorf("tls handshake with %s: %w", tc.RemoteAddr(), err))
+					return
+				}
+				tc.SetDeadline(time.Time{})
+				this.addConn(tc)
+			}()
+			continue
+		}
+		this.addConn(c)
 	}
 }
 
-func (this *tcpServer) getConn() map[string]net.Conn {
-	m := map[string]net.Conn{}
+// addConn 添加连接,开始推送数据,最近的日志在连接的协程中先发送,不阻塞其他连接
+func (this *tcpServer) addConn(c net.Conn) {
+	key := c.RemoteAddr().String()
+	sc := &tcpServerConn{Conn: c, queue: make(chan []byte, 100), done: make(chan struct{})}
+	this.mu.Lock()
+	backlog := this.backlogBytes()
+	this.conn[key] = sc
+	this.mu.Unlock()
+	go func() {
+		if err := sc.run(backlog, TCPServerWriteTimeout); err != nil {
+			this.mu.Lock()
+			if this.conn[key] == sc {
+				delete(this.conn, key)
+			}
+			this.mu.Unlock()
+			sc.Close()
+		}
+	}()
+}
+
+func (this *tcpServer) getConn() map[string]*tcpServerConn {
+	m := map[string]*tcpServerConn{}
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 	for i, v := range this.conn {
@@ -164,10 +544,71 @@ func (this *tcpServer) getConn() map[string]net.Conn {
 	return m
 }
 
+// delConn 删除并关闭连接
 func (this *tcpServer) delConn(key ...string) {
 	this.mu.Lock()
+	defer this.mu.Unlock()
 	for _, v := range key {
-		delete(this.conn, v)
+		if c, ok := this.conn[v]; ok {
+			c.Close()
+			delete(this.conn, v)
+		}
 	}
-	this.mu.Unlock()
+}
+
+// tcpServerConn 服务端的一个连接,数据加入发送队列,在协程中按顺序发送
+type tcpServerConn struct {
+	net.Conn
+	queue chan []byte   //发送队列
+	done  chan struct{} //连接已关闭
+	once  sync.Once
+}
+
+// run 先发送最近的日志,再发送队列中的数据,直到发送失败或连接关闭
+func (this *tcpServerConn) run(backlog []byte, timeout time.Duration) error {
+	if len(backlog) > 0 {
+		this.Conn.SetWriteDeadline(time.Now().Add(BacklogWriteTimeout))
+		if _, err := this.Conn.Write(backlog); err != nil {
+			return err
+		}
+		this.Conn.SetWriteDeadline(time.Time{})
+	}
+	for {
+		select {
+		case <-this.done:
+			return nil
+		case bs := <-this.queue:
+			if timeout > 0 {
+				this.Conn.SetWriteDeadline(time.Now().Add(timeout))
+			}
+			if _, err := this.Conn.Write(bs); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// send 加入发送队列,不阻塞,队列满了返回ErrQueueFull,连接已关闭返回ErrClosed
+func (this *tcpServerConn) send(frame []byte) error {
+	select {
+	case <-this.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case this.queue <- frame:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close 关闭连接,停止发送
+func (this *tcpServerConn) Close() error {
+	err := error(nil)
+	this.once.Do(func() {
+		close(this.done)
+		err = this.Conn.Close()
+	})
+	return err
 }
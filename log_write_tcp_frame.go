@@ -0,0 +1,97 @@
+package logs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+//==============================Frame==============================
+
+/*
+	TCP传输的帧格式,一帧对应一条日志,大端:
+
+	| 长度(4) | 版本(1) | 等级(1) | 时间戳纳秒(8) | 名称长度(2) | 名称 | 数据 |
+
+	长度为版本到数据结尾的字节数
+*/
+
+const (
+	// FrameVersion 当前的帧格式版本
+	FrameVersion uint8 = 1
+
+	frameHeadSize = 1 + 1 + 8 + 2 //长度之后的固定头部
+)
+
+var (
+	// MaxFrameSize 接收的最大帧长度,超出则断开连接,防止异常数据占用内存
+	MaxFrameSize = 16 << 20
+
+	// ErrFrameVersion 不支持的帧格式版本
+	ErrFrameVersion = errors.New("logs: unsupported frame version")
+)
+
+// Frame 一帧日志数据
+type Frame struct {
+	Version uint8     //帧格式版本
+	Level   Level     //日志等级
+	Name    string    //实体名称,例如 信息
+	Time    time.Time //日志时间
+	Data    []byte    //格式化后的日志
+}
+
+// encodeFrame 记录和数据编码成帧,记录为nil时(例如直接写入的字节)等级为LevelAll,时间为当前时间
+func encodeFrame(r *Record, p []byte) []byte {
+	level, name, t := LevelAll, "", time.Now()
+	if r != nil {
+		level, name = r.Level, r.Name
+		if !r.Time.IsZero() {
+			t = r.Time
+		}
+	}
+	if len(name) > 0xFFFF {
+		name = name[:0xFFFF]
+	}
+	size := frameHeadSize + len(name) + len(p)
+	bs := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(bs, uint32(size))
+	bs[4] = FrameVersion
+	bs[5] = byte(level)
+	binary.BigEndian.PutUint64(bs[6:], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint16(bs[14:], uint16(len(name)))
+	copy(bs[16:], name)
+	copy(bs[16+len(name):], p)
+	return bs
+}
+
+// readFrame 读取一帧数据
+func readFrame(r io.Reader) (*Frame, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(head))
+	if size < frameHeadSize || size > MaxFrameSize {
+		return nil, fmt.Errorf("logs: invalid frame size %d", size)
+	}
+	bs := make([]byte, size)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return nil, err
+	}
+	if bs[0] != FrameVersion {
+		return nil, ErrFrameVersion
+	}
+	nameLen := int(binary.BigEndian.Uint16(bs[10:]))
+	if frameHeadSize+nameLen > size {
+		return nil, fmt.Errorf("logs: invalid frame name length %d", nameLen)
+	}
+	return &Frame{
+		Version: bs[0],
+		Level:   Level(bs[1]),
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(bs[2:]))),
+		Name:    string(bs[frameHeadSize : frameHeadSize+nameLen]),
+		Data:    bs[frameHeadSize+nameLen:],
+	}, nil
+}
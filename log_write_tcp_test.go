@@ -0,0 +1,415 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	now := time.Now()
+	buf := bytes.NewBuffer(nil)
+	buf.Write(encodeFrame(&Record{Level: LevelWarn, Name: "警告", Time: now}, []byte("a\nb\n")))
+	buf.Write(encodeFrame(nil, []byte("c\n")))
+	f, err := readFrame(buf)
+	if err != nil || f.Level != LevelWarn || f.Name != "警告" || !f.Time.Equal(now) || string(f.Data) != "a\nb\n" {
+		t.Fatalf("unexpected frame %+v %v", f, err)
+	}
+	if f, err = readFrame(buf); err != nil || f.Name != "" || string(f.Data) != "c\n" {
+		t.Fatalf("unexpected frame %+v %v", f, err)
+	}
+
+	bs := encodeFrame(nil, nil)
+	bs[4] = FrameVersion + 1
+	if _, err := readFrame(bytes.NewReader(bs)); err != ErrFrameVersion {
+		t.Fatalf("expected ErrFrameVersion, got %v", err)
+	}
+}
+
+func TestTCPFrame(t *testing.T) {
+	w, err := NewTCPServer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := w.(*tcpServer)
+	defer server.Close()
+
+	frames := make(chan *Frame, 100)
+	client, err := DialTCPFrame(server.listener.Addr().String(), func(f *Frame) { frames <- f })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; len(server.getConn()) == 0; i++ {
+		if i > 100 {
+			t.Fatal("client not connected")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	e := NewEntity("信息").SetWriter(server).SetShowColor(false).SetFormatter(FormatFunc(func(e *Entity, msg string) string { return msg }))
+	for i := 0; i < 100; i++ {
+		e.Printf("line %d\n", i)
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case f := <-frames:
+			if want := fmt.Sprintf("line %d\n", i); string(f.Data) != want || f.Name != "信息" {
+				t.Fatalf("unexpected frame %q %q, want %q", f.Name, f.Data, want)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout at %d", i)
+		}
+	}
+}
+
+func TestTCPClientReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	events := make(chan string, 10)
+	w, err := NewTCPClientWith(addr, TCPClientOption{
+		Lazy:         true,
+		MinBackoff:   time.Millisecond * 10,
+		MaxBackoff:   time.Millisecond * 50,
+		OnConnect:    func(addr string) { events <- "connect" },
+		OnDisconnect: func(addr string, err error) { events <- "disconnect" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.(*tcpClient).Close()
+	wait := func(want string) {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("expected %s, got %s", want, got)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout waiting %s", want)
+		}
+	}
+
+	//服务器启动后自动连接
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait("connect")
+	w.Write([]byte("hello\n"))
+	f, err := readFrame(c)
+	if err != nil || string(f.Data) != "hello\n" {
+		t.Fatalf("unexpected frame %v %v", f, err)
+	}
+
+	//服务器断开后重连
+	c.Close()
+	wait("disconnect")
+	if c, err = l.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	wait("connect")
+}
+
+func TestTCPClientDropped(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var mu sync.Mutex
+	var reported []error
+	OnError(func(w io.Writer, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	})
+	defer OnError(nil)
+	w, err := NewTCPClientWith(addr, TCPClientOption{Lazy: true, MinBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := w.(*tcpClient)
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		c.Write([]byte("hello\n"))
+	}
+	if err := c.Flush(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().Dropped; n != 3 {
+		t.Fatalf("expected 3 dropped, got %d", n)
+	}
+	c.reportDropped(context.Background(), 0)
+	if n := c.Stats().Dropped; n != 3 {
+		t.Fatalf("drop report counted as dropped: %d", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !errors.Is(reported[0], errNotConnected) {
+		t.Fatalf("unexpected reported: %v", reported)
+	}
+}
+
+func TestDialTCPClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	client, err := DialTCPFrame(l.Addr().String(), func(f *Frame) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := <-accepted
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := closers.Load(client); ok {
+		t.Fatal("closed dialer still registered")
+	}
+
+	//关闭后客户端断开,不再重连
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection closed, got %v", err)
+	}
+	c.Close()
+	select {
+	case <-accepted:
+		t.Fatal("unexpected reconnect")
+	case <-time.After(time.Millisecond * 1500):
+	}
+}
+
+// newTestCert 生成测试用的证书,parent为nil时生成自签名的CA
+func newTestCert(t *testing.T, parent *tls.Certificate, isCA bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "logs"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parentCert, parentKey := tpl, interface{}(key)
+	if parent != nil {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestTCPServerTLS(t *testing.T) {
+	ca := newTestCert(t, nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	serverCert, clientCert := newTestCert(t, &ca, false), newTestCert(t, &ca, false)
+
+	oldWriter := ErrorWriter
+	defer func() { ErrorWriter = oldWriter }()
+	warn := &syncBuffer{}
+	ErrorWriter = warn
+
+	w, err := NewTCPServerTLS(0, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := w.(*tcpServer)
+	defer server.Close()
+	addr := fmt.Sprintf("127.0.0.1:%d", server.listener.Addr().(*net.TCPAddr).Port)
+
+	//没有客户端证书,握手失败
+	c, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool})
+	if err == nil {
+		_, err = c.Read(make([]byte, 1))
+		c.Close()
+	}
+	if err == nil {
+		t.Fatal("expected handshake failure without client certificate")
+	}
+	for i := 0; warn.Count("tls handshake") == 0; i++ {
+		if i > 100 {
+			t.Fatal("handshake failure not reported")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	//双向认证
+	frames := make(chan *Frame, 10)
+	client, err := DialTCPTLS(addr, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}}, func(p []byte) {
+		frames <- &Frame{Data: p}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; len(server.getConn()) == 0; i++ {
+		if i > 100 {
+			t.Fatal("client not connected")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	server.Write([]byte("hello\n"))
+	select {
+	case f := <-frames:
+		if string(f.Data) != "hello\n" {
+			t.Fatalf("unexpected data %q", f.Data)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
+
+func TestTCPServerBacklog(t *testing.T) {
+	for _, v := range []struct {
+		op    TCPServerOption
+		sleep time.Duration
+		want  []string
+	}{
+		{TCPServerOption{Backlog: 3}, 0, []string{"line 2", "line 3", "line 4", "live"}},
+		{TCPServerOption{}, 0, []string{"live"}},
+		{TCPServerOption{Backlog: 3, BacklogAge: time.Millisecond * 50}, time.Millisecond * 100, []string{"live"}},
+	} {
+		w, err := NewTCPServerWith(0, v.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := w.(*tcpServer)
+		for i := 0; i < 5; i++ {
+			server.Write([]byte(fmt.Sprintf("line %d", i)))
+		}
+		server.Flush(time.Second)
+		time.Sleep(v.sleep)
+
+		frames := make(chan string, 10)
+		if err := DialTCP(server.listener.Addr().String(), func(p []byte) { frames <- string(p) }); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; len(server.getConn()) == 0; i++ {
+			if i > 100 {
+				t.Fatal("client not connected")
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		server.Write([]byte("live"))
+		for _, want := range v.want {
+			select {
+			case got := <-frames:
+				if got != want {
+					t.Fatalf("%+v: expected %q, got %q", v.op, want, got)
+				}
+			case <-time.After(time.Second * 3):
+				t.Fatalf("%+v: timeout waiting %q", v.op, want)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestTCPServerSlowClient(t *testing.T) {
+	w, err := NewTCPServer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := w.(*tcpServer)
+	defer server.Close()
+	addr := server.listener.Addr().String()
+
+	//不读取数据的客户端
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	var mu sync.Mutex
+	received := 0
+	client, err := DialTCPFrame(addr, func(f *Frame) {
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; len(server.getConn()) < 2; i++ {
+		if i > 100 {
+			t.Fatal("client not connected")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	//每次写入50帧,等待正常的客户端收完,不读取的客户端不影响其他客户端
+	data := bytes.Repeat([]byte("x"), 64<<10)
+	for i := 0; i < 400; i += 50 {
+		for j := 0; j < 50; j++ {
+			server.Write(data)
+		}
+		for k := 0; ; k++ {
+			mu.Lock()
+			n := received
+			mu.Unlock()
+			if n == i+50 {
+				break
+			}
+			if k > 300 {
+				t.Fatalf("healthy client received %d of %d", n, i+50)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	if server.Stats().Dropped == 0 {
+		t.Fatal("expected frames dropped for the slow client")
+	}
+}
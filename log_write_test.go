@@ -0,0 +1,31 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAddWriterWith(t *testing.T) {
+	console, file, tcp := bytes.NewBuffer(nil), bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	info := NewEntity("信息").SetSelfLevel(LevelInfo).SetWriter(console).SetShowColor(false)
+	info.AddWriterWith(file, WriterOption{Formatter: FJsonRecord})
+	info.AddWriterWith(tcp, WriterOption{Level: LevelWarn})
+	warn := NewEntity("警告").SetSelfLevel(LevelWarn).SetWriter().SetShowColor(false)
+	warn.AddWriterWith(tcp, WriterOption{Level: LevelWarn})
+
+	info.Println("hello")
+	warn.Println("warn")
+
+	if got := console.String(); !strings.HasSuffix(got, ": hello\n") {
+		t.Fatalf("unexpected console output: %q", got)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(file.Bytes(), &m); err != nil || m["msg"] != "hello" {
+		t.Fatalf("unexpected file output: %q", file.String())
+	}
+	if got := tcp.String(); !strings.HasPrefix(got, "[警告]") || !strings.HasSuffix(got, ": warn\n") {
+		t.Fatalf("unexpected tcp output: %q", got)
+	}
+}
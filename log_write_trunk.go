@@ -29,31 +29,100 @@ func (this *trunk) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// WriteRecord 实现IRecordWriter接口,订阅者能收到日志记录
+func (this *trunk) WriteRecord(r *Record, p []byte) (int, error) {
+	this.publish(&chanItem{r: r, p: p})
+	return len(p), nil
+}
+
 // Publish 发布接口输入
 func (this *trunk) Publish(data ...[]byte) {
-	for _, sub := range this.subscribe {
+	for _, v := range data {
+		this.publish(&chanItem{p: v})
+	}
+}
+
+func (this *trunk) publish(item *chanItem) {
+	this.Lock()
+	subs := this.subscribe
+	this.Unlock()
+	for _, sub := range subs {
 		if sub != nil {
-			sub.try(data...)
+			sub.try(item)
 		}
 	}
 }
 
 // Subscribe 订阅消息总线
 func (this *trunk) Subscribe(bufSize int, handler func(data []byte)) string {
+	return this.subscribeItem(bufSize, func(item *chanItem) {
+		if handler != nil {
+			handler(item.p)
+		}
+	})
+}
+
+// SubscribeRecord 订阅消息总线,能收到日志记录,直接发布的数据记录为nil
+func (this *trunk) SubscribeRecord(bufSize int, handler func(r *Record, data []byte)) string {
+	return this.subscribeItem(bufSize, func(item *chanItem) {
+		if handler != nil {
+			handler(item.r, item.p)
+		}
+	})
+}
+
+func (this *trunk) subscribeItem(bufSize int, handler func(item *chanItem)) string {
 	key := fmt.Sprintf("%p-%p-%d", this, handler, time.Now().UnixNano())
-	ctx, cancel := context.WithCancel(context.Background())
 	sub := &trunkSubscribe{
-		key:     key,
-		handler: handler,
-		c:       make(chan []byte, bufSize),
-		ctx:     ctx,
-		cancel:  cancel,
+		key:  key,
+		Chan: newChan(context.Background(), bufSize),
 	}
-	go sub.run()
+	sub.Chan.handler = func(ctx context.Context, count int, r *Record, bs []byte) {
+		handler(&chanItem{r: r, p: bs})
+	}
+	this.Lock()
 	this.subscribe = append(this.subscribe, sub)
+	this.Unlock()
 	return key
 }
 
+// GetSubscribe 获取订阅的队列,可以设置队列满了之后的处理方式和查看统计
+func (this *trunk) GetSubscribe(key string) *Chan {
+	this.Lock()
+	defer this.Unlock()
+	for _, v := range this.subscribe {
+		if v.key == key {
+			return v.Chan
+		}
+	}
+	return nil
+}
+
+// Flush 等待所有订阅处理完队列中的数据
+func (this *trunk) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	this.Lock()
+	subs := append([]*trunkSubscribe(nil), this.subscribe...)
+	this.Unlock()
+	for _, sub := range subs {
+		if err := sub.Flush(time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 停止所有订阅,需要先处理完的话先执行Flush
+func (this *trunk) Close() error {
+	this.Lock()
+	defer this.Unlock()
+	for _, v := range this.subscribe {
+		v.Close()
+	}
+	this.subscribe = nil
+	return nil
+}
+
 // Unsubscribe 取消订阅
 func (this *trunk) Unsubscribe(key string) bool {
 	if len(key) == 0 {
@@ -64,41 +133,15 @@ func (this *trunk) Unsubscribe(key string) bool {
 	for i, v := range this.subscribe {
 		if v.key == key {
 			this.subscribe = append(this.subscribe[:i], this.subscribe[i+1:]...)
-			v.cancel()
+			v.Close()
 			return true
 		}
 	}
 	return false
 }
 
+// trunkSubscribe 订阅,每个订阅有单独的队列
 type trunkSubscribe struct {
-	key     string
-	handler func(data []byte)
-	c       chan []byte
-	ctx     context.Context
-	cancel  context.CancelFunc
-}
-
-func (this *trunkSubscribe) try(data ...[]byte) {
-	for _, v := range data {
-		select {
-		case <-this.ctx.Done():
-			return
-		case this.c <- v:
-		default:
-		}
-	}
-}
-
-func (this *trunkSubscribe) run() {
-	for {
-		select {
-		case <-this.ctx.Done():
-			return
-		case data := <-this.c:
-			if this.handler != nil {
-				this.handler(data)
-			}
-		}
-	}
+	key string
+	*Chan
 }